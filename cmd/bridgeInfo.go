@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"github.com/techwolf12/artnet-to-hue/pkg/config"
 	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -44,6 +46,26 @@ func bridgeInfoHandler(cmd *cobra.Command, args []string) {
 	}
 	for _, zone := range entertainmentZones {
 		fmt.Printf("ID: %s, Name: %s, Status: %s\n", zone.ID, zone.Name, zone.Status)
+		artnetConfig.EntertainmentZone = zone.ID
+		channels, err := hue.GetEntertainmentChannels(artnetConfig)
+		if err != nil {
+			fmt.Printf("  Error fetching channels: %v\n", err)
+			continue
+		}
+		for i, channel := range channels {
+			fmt.Printf("  Light %d: Channel: %d, Lights: %s, Position: (%.2f, %.2f, %.2f)\n",
+				i+1, channel.ID, channelName(channel), channel.Position.X, channel.Position.Y, channel.Position.Z)
+		}
+		for _, device := range hue.Devices(channels) {
+			if len(device.Lights) < 2 {
+				continue
+			}
+			lights := make([]string, len(device.Lights))
+			for i, light := range device.Lights {
+				lights[i] = strconv.Itoa(light + 1)
+			}
+			fmt.Printf("  Device %s (%s): %d segments, lights %s\n", device.Name, device.ModelID, len(device.Lights), strings.Join(lights, ", "))
+		}
 	}
 }
 
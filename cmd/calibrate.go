@@ -0,0 +1,233 @@
+/*
+Copyright © 2025 Christiaan de Die le Clercq <contact@techwolf12.nl>
+
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/calibration"
+	artnetHueConfig "github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"github.com/techwolf12/artnet-to-hue/pkg/output"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// calibrateCmd represents the calibrate command
+var calibrateCmd = &cobra.Command{
+	Use:   "calibrate",
+	Short: "Match the colours of the lights in an entertainment zone",
+	Long: `Show reference colours on all lights of an entertainment zone and adjust the gains and brightness of
+every light until they match. The result is printed as calibration entries for the config file.`,
+	Run: calibrateRun,
+}
+
+type referenceColor struct {
+	name  string
+	state hue.EntertainmentLightState
+}
+
+var referenceColors = []referenceColor{
+	{name: "white", state: hue.EntertainmentLightState{Red: 65535, Green: 65535, Blue: 65535}},
+	{name: "grey", state: hue.EntertainmentLightState{Red: 16384, Green: 16384, Blue: 16384}},
+	{name: "red", state: hue.EntertainmentLightState{Red: 65535}},
+	{name: "green", state: hue.EntertainmentLightState{Green: 65535}},
+	{name: "blue", state: hue.EntertainmentLightState{Blue: 65535}},
+	{name: "amber", state: hue.EntertainmentLightState{Red: 65535, Green: 49151}},
+}
+
+func calibrateRun(cmd *cobra.Command, args []string) {
+	var config artnetHueConfig.Config
+	path, _ := cmd.Flags().GetString("config")
+	if path != "" {
+		var err error
+		config, err = artnetHueConfig.Load(path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+	overlayIP(cmd, "hue-bridge-ip", &config.HueBridgeIP)
+	overlayString(cmd, "username", &config.Username)
+	overlayString(cmd, "client-key", &config.ClientKey)
+	overlayString(cmd, "entertainment-zone", &config.EntertainmentZone)
+	if config.HueBridgeIP == nil || config.HueBridgeIP.IsUnspecified() {
+		fmt.Println("Error: Hue bridge IP address is required")
+		return
+	}
+	if config.Username == "" || config.ClientKey == "" || config.EntertainmentZone == "" {
+		fmt.Println("Error: Username, client key and entertainment zone are required")
+		return
+	}
+	// Calibrate the colours as the lights render them, without the colour mode of the config file
+	config.ColorMode = hue.ColorModeRGB
+
+	channels, err := hue.GetEntertainmentChannels(config)
+	if err != nil {
+		fmt.Printf("Error fetching entertainment channels: %v\n", err)
+		return
+	}
+	config.NumLights = len(channels)
+
+	// Start from the existing calibration of every light, whether its entry selects it by light, name or model
+	matches, err := calibration.Match(config, channels)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	entries := make([]artnetHueConfig.Calibration, len(channels))
+	for i := range entries {
+		entries[i] = artnetHueConfig.Calibration{Light: i + 1, Gains: &[3]float64{1, 1, 1}, Brightness: new(float64)}
+		*entries[i].Brightness = 1
+		if matches[i] < 0 {
+			continue
+		}
+		entry := config.Calibration[matches[i]]
+		if entry.Gains != nil {
+			entries[i].Gains = entry.Gains
+		}
+		if entry.Brightness != nil {
+			entries[i].Brightness = entry.Brightness
+		}
+		entries[i].Matrix = entry.Matrix
+		entries[i].WhitePoint = entry.WhitePoint
+	}
+
+	hueOutput, err := output.New("hue", config, channels)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	defer func() {
+		err := hueOutput.Close()
+		if err != nil {
+			log.Printf("Failed to close Hue output: %v", err)
+		}
+	}()
+
+	var mu sync.Mutex
+	reference := referenceColors[0]
+	done := make(chan struct{})
+	// The bridge leaves entertainment mode when it stops receiving frames, so keep streaming
+	go func() {
+		ticker := time.NewTicker(40 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			mu.Lock()
+			states := make([]hue.EntertainmentLightState, len(entries))
+			for i, entry := range entries {
+				transform, err := calibration.NewTransform(entry)
+				if err != nil {
+					transform, _ = calibration.NewTransform(artnetHueConfig.Calibration{})
+				}
+				states[i] = transform.Apply(reference.state)
+			}
+			mu.Unlock()
+			if err := hueOutput.Write(states); err != nil {
+				log.Printf("Failed to stream to Hue: %v", err)
+			}
+		}
+	}()
+	defer close(done)
+
+	fmt.Println("For every reference colour, adjust each light until it matches the others.")
+	fmt.Println("Enter `red green blue` gains, optionally followed by a brightness, or an empty line to continue.")
+	scanner := bufio.NewScanner(os.Stdin)
+	for _, ref := range referenceColors {
+		mu.Lock()
+		reference = ref
+		mu.Unlock()
+		fmt.Printf("\nShowing %s on all lights\n", ref.name)
+		for i, channel := range channels {
+			for {
+				mu.Lock()
+				entry := entries[i]
+				fmt.Printf("Light %d (%s, %s) gains %.2f %.2f %.2f, brightness %.2f > ", i+1, channelName(channel),
+					channelModel(channel), entry.Gains[0], entry.Gains[1], entry.Gains[2], *entry.Brightness)
+				mu.Unlock()
+				if !scanner.Scan() {
+					printCalibration(entries)
+					return
+				}
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" {
+					break
+				}
+				gains, brightness, err := parseCalibrationInput(line, *entry.Gains, *entry.Brightness)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				mu.Lock()
+				entries[i].Gains = &gains
+				entries[i].Brightness = &brightness
+				mu.Unlock()
+			}
+		}
+	}
+	printCalibration(entries)
+}
+
+func channelModel(channel hue.EntertainmentChannel) string {
+	for _, member := range channel.Members {
+		if member.ModelID != "" {
+			return member.ModelID
+		}
+	}
+	return "unknown model"
+}
+
+// parseCalibrationInput parses `red green blue [brightness]`.
+func parseCalibrationInput(line string, gains [3]float64, brightness float64) ([3]float64, float64, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 && len(fields) != 4 {
+		return gains, brightness, fmt.Errorf("expected 3 gains and an optional brightness, got %d values", len(fields))
+	}
+	values := make([]float64, len(fields))
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil || v < 0 {
+			return gains, brightness, fmt.Errorf("invalid value %q", field)
+		}
+		values[i] = v
+	}
+	copy(gains[:], values[:3])
+	if len(values) == 4 {
+		brightness = values[3]
+	}
+	return gains, brightness, nil
+}
+
+func printCalibration(entries []artnetHueConfig.Calibration) {
+	out, err := json.MarshalIndent(map[string]interface{}{"calibration": entries}, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode calibration: %v", err)
+		return
+	}
+	fmt.Println("\nAdd the following to the config file:")
+	fmt.Println(string(out))
+}
+
+func init() {
+	rootCmd.AddCommand(calibrateCmd)
+
+	calibrateCmd.Flags().StringP("config", "f", "", "JSON config file to read the bridge settings and existing calibration from")
+	calibrateCmd.Flags().IPP("hue-bridge-ip", "i", nil, "IP address of the hue bridge")
+	calibrateCmd.Flags().StringP("username", "u", "", "Username for the hue bridge")
+	calibrateCmd.Flags().StringP("client-key", "c", "", "Client key for the hue bridge (used for DTLS authentication)")
+	calibrateCmd.Flags().StringP("entertainment-zone", "e", "", "Entertainment zone ID for the hue bridge")
+}
@@ -6,10 +6,28 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/techwolf12/artnet-to-hue/pkg/artnet"
-	artnetHueConfig "github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/api"
+	_ "github.com/techwolf12/artnet-to-hue/pkg/artnet"
+	"github.com/techwolf12/artnet-to-hue/pkg/calibration"
+	"github.com/techwolf12/artnet-to-hue/pkg/ddp"
+	"github.com/techwolf12/artnet-to-hue/pkg/delay"
+	"github.com/techwolf12/artnet-to-hue/pkg/fixture"
 	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"github.com/techwolf12/artnet-to-hue/pkg/opc"
+	"github.com/techwolf12/artnet-to-hue/pkg/osc"
+	"github.com/techwolf12/artnet-to-hue/pkg/output"
+	"github.com/techwolf12/artnet-to-hue/pkg/park"
+	"github.com/techwolf12/artnet-to-hue/pkg/pipeline"
+	"github.com/techwolf12/artnet-to-hue/pkg/source"
+	"github.com/techwolf12/artnet-to-hue/pkg/strobe"
 	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -22,122 +40,245 @@ var serverCmd = &cobra.Command{
 }
 
 func serverRun(cmd *cobra.Command, args []string) {
-	hueBridgeIP, _ := cmd.Flags().GetIP("hue-bridge-ip")
-	if hueBridgeIP.IsUnspecified() {
-		fmt.Println("Error: Hue bridge IP address is required")
+	config, err := loadServerConfig(cmd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		return
 	}
-	username, _ := cmd.Flags().GetString("username")
-	if username == "" {
-		fmt.Println("Error: Username for the Hue bridge is required")
-		return
+	if config.Debug {
+		fmt.Println("Debug mode is enabled")
 	}
-	clientKey, _ := cmd.Flags().GetString("client-key")
-	if clientKey == "" {
-		fmt.Println("Error: Client key for the Hue bridge is required")
-		return
+	fmt.Printf("Starting server with:\n Hue Bridge IP: %s\n Entertainment Zone: %s\n Inputs: %s\n Outputs: %s\n Art-Net Universe: %d\n Art-Net DMX Start: %d\n",
+		config.HueBridgeIP, config.EntertainmentZone, strings.Join(config.Inputs, ", "), strings.Join(config.Outputs, ", "), config.ArtNetUniverse, config.ArtNetStartAddress)
+
+	// With the bridge settings available, patch entries can refer to channels and lights by name
+	var channels []hue.EntertainmentChannel
+	if config.HueBridgeIP != nil && config.Username != "" && config.EntertainmentZone != "" {
+		channels, err = hue.GetEntertainmentChannels(config)
+		if err != nil {
+			fmt.Printf("Error: failed to get entertainment channels: %v\n", err)
+			return
+		}
+		if config.NumLights == 0 {
+			config.NumLights = len(channels)
+		}
+		if config.NumLights > len(channels) {
+			fmt.Printf("Error: %d lights configured but the entertainment zone only has %d channels\n", config.NumLights, len(channels))
+			return
+		}
+		config.Patch, err = fixture.ResolvePatch(config.Patch, config.Profile, channels)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		for i, channel := range channels {
+			fmt.Printf(" Light %d: channel %d (%s)\n", i+1, channel.ID, channelName(channel))
+		}
 	}
-	entertainmentZone, _ := cmd.Flags().GetString("entertainment-zone")
-	if entertainmentZone == "" {
-		fmt.Println("Error: Entertainment zone ID is required")
+
+	if config.NumLights == 0 {
+		fmt.Println("Error: Number of lights is required when the entertainment zone cannot be read from the bridge")
 		return
 	}
-	numLights, _ := cmd.Flags().GetInt("lights")
-	if numLights <= 0 {
-		fmt.Println("Error: Number of lights in the entertainment zone must be a positive integer")
+	// Without the bridge the zone can have at most the channels CLIP v2 supports
+	if channels == nil && config.NumLights > hue.MaxChannels {
+		fmt.Printf("Error: number of lights in the entertainment zone cannot exceed %d\n", hue.MaxChannels)
 		return
 	}
-	if numLights > 10 {
-		fmt.Println("Error: Number of lights in the entertainment zone cannot exceed 10")
+	fmt.Printf(" Lights: %d\n", config.NumLights)
+
+	decoder, err := fixture.NewDecoder(config, channels)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		return
 	}
-	debug, _ := cmd.Flags().GetBool("debug")
-	if debug {
-		fmt.Println("Debug mode is enabled")
-	}
-	artnetUniverse, _ := cmd.Flags().GetUint16("artnet-universe")
-	if artnetUniverse < 0 {
-		fmt.Println("Error: Art-Net universe must be a non-negative integer")
+	calibrator, err := calibration.New(config, channels)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		return
 	}
-	artnetDMXStart, _ := cmd.Flags().GetInt("artnet-dmx-start")
-	if artnetDMXStart < 0 {
-		fmt.Println("Error: Art-Net DMX start channel must be a non-negative integer")
+	parker, err := park.New(config, channels)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		return
 	}
-	config := artnetHueConfig.Config{
-		HueBridgeIP:        hueBridgeIP,
-		Username:           username,
-		ClientKey:          clientKey,
-		EntertainmentZone:  entertainmentZone,
-		NumLights:          numLights,
-		ArtNetUniverse:     artnetUniverse,
-		ArtNetStartAddress: artnetDMXStart,
-		Debug:              debug,
+	if config.HTTPListen != "" {
+		apiServer := api.NewServer(config.HTTPListen, parker)
+		if err := apiServer.Start(); err != nil {
+			fmt.Printf("Error: failed to start HTTP API: %v\n", err)
+			return
+		}
+		defer func() {
+			err := apiServer.Stop()
+			if err != nil {
+				log.Printf("Failed to stop HTTP API: %v", err)
+			}
+		}()
+		fmt.Printf(" HTTP API: %s\n", config.HTTPListen)
 	}
-	fmt.Printf("Starting server with:\n Hue Bridge IP: %s\n Entertainment Zone: %s\n Art-Net Universe: %d\n Art-Net DMX Start: %d\n",
-		hueBridgeIP, entertainmentZone, artnetUniverse, artnetDMXStart)
 
-	listener, err := artnet.NewListener(config)
-	if err != nil {
-		panic(err)
+	var sources []source.Source
+	for _, name := range config.Inputs {
+		src, err := source.New(name, config)
+		if err != nil {
+			log.Printf("Failed to create input %s: %v", name, err)
+			return
+		}
+		sources = append(sources, src)
 	}
 
-	hueAppId, err := hue.GetHueApplicationID(config)
+	var sink output.Fanout
+	for _, name := range config.Outputs {
+		out, err := output.New(name, config, channels)
+		if err != nil {
+			log.Printf("Failed to create output %s: %v", name, err)
+			_ = sink.Close()
+			return
+		}
+		sink = append(sink, out)
+	}
+	// Strobing lights are rendered after all other processing
+	out := strobe.New(sink, *config.StrobeMaxRate)
+	defer func() {
+		err := out.Close()
+		if err != nil {
+			log.Printf("Failed to close outputs: %v", err)
+		}
+	}()
+
+	limiter, err := pipeline.NewLimiter(config)
 	if err != nil {
-		log.Printf("Failed to get Hue application ID: %v", err)
+		fmt.Printf("Error: %v\n", err)
 		return
 	}
-
-	err = hue.StartEntertainmentArea(config)
+	blackLevel, err := pipeline.NewBlackLevel(config)
 	if err != nil {
-		log.Printf("Failed to start entertainment area: %v", err)
+		fmt.Printf("Error: %v\n", err)
 		return
 	}
-	streamer := &hue.Streamer{}
-	err = streamer.Connect(config, hueAppId)
+	delays, err := delay.Delays(config)
 	if err != nil {
-		log.Printf("Failed to connect to Hue bridge: %v", err)
+		fmt.Printf("Error: %v\n", err)
 		return
 	}
-	fmt.Println("Ready to receive Art-Net packets and stream to Hue lights!")
+	processors, err := pipeline.Select(config.Pipeline, []pipeline.Processor{
+		pipeline.NewDecode(decoder),
+		pipeline.NewMerge(),
+		pipeline.StateFunc(pipeline.StageMaster, decoder.Master),
+		pipeline.StateFunc(pipeline.StageGamma, decoder.Curve),
+		pipeline.NewSmoothing(config.Smoothing),
+		pipeline.StateFunc(pipeline.StagePark, parker.Apply),
+		limiter,
+		pipeline.StateFunc(pipeline.StageCalibration, calibrator.Apply),
+		blackLevel,
+		delay.New(delays),
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	pipe := pipeline.New(decoder, processors, out, config.Debug)
+	fmt.Printf(" Pipeline: %s\n", strings.Join(config.Pipeline, ", "))
 
-	listener.OnUpdate(func(values []byte) {
-		if config.Debug {
-			log.Printf("DMX values: %v\n", values)
-		}
-		if len(values) < config.NumLights*3 {
-			log.Printf("Received fewer values than expected for %d lights: %d values received", config.NumLights, len(values))
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		err := src.Start()
+		if err != nil {
+			log.Printf("Failed to start input %s: %v", src.Name(), err)
+			stopSources(sources)
 			return
 		}
-		states := make([]hue.EntertainmentLightState, config.NumLights)
-		for i := 0; i < config.NumLights; i++ {
-			startIndex := i * 3
-			states[i] = hue.EntertainmentLightState{
-				Red:   int(values[startIndex]),
-				Green: int(values[startIndex+1]),
-				Blue:  int(values[startIndex+2]),
+		wg.Add(1)
+		go func(src source.Source) {
+			defer wg.Done()
+			for frame := range src.Frames() {
+				pipe.Process(frame)
+			}
+		}(src)
+	}
+
+	// Lights that change without new frames, like spinning colour wheels or smoothed fades, are rendered at the rate the bridge updates its lights
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Second / hue.LightUpdateRate)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				pipe.Render(now)
 			}
 		}
-		err := streamer.StreamToHue(config, states)
+	}()
+	fmt.Println("Ready to receive input and send it to the outputs!")
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	fmt.Println("Shutting down...")
+	stopSources(sources)
+	close(done)
+	wg.Wait()
+	for _, src := range sources {
+		stats := src.Stats()
+		fmt.Printf("%s: %d packets, %d frames, %d invalid, %d dropped\n", src.Name(), stats.Packets, stats.Frames, stats.Invalid, stats.Dropped)
+	}
+}
+
+func stopSources(sources []source.Source) {
+	for _, src := range sources {
+		err := src.Stop()
 		if err != nil {
-			log.Printf("Failed to stream to Hue: %v", err)
-			return
+			log.Printf("Failed to stop input %s: %v", src.Name(), err)
 		}
-	})
+	}
+}
 
-	select {}
+// channelName returns the names of the lights that make up a channel.
+func channelName(channel hue.EntertainmentChannel) string {
+	var names []string
+	for _, member := range channel.Members {
+		if !slices.Contains(names, member.Name) {
+			names = append(names, member.Name)
+		}
+	}
+	return strings.Join(names, ", ")
 }
 
 func init() {
 	rootCmd.AddCommand(serverCmd)
 
+	serverCmd.Flags().StringP("config", "f", "", "JSON config file, flags given on the command line override its values")
 	serverCmd.Flags().IPP("hue-bridge-ip", "i", nil, "IP address of the hue bridge")
 	serverCmd.Flags().StringP("username", "u", "", "Username for the hue bridge")
 	serverCmd.Flags().StringP("client-key", "c", "", "Client key for the hue bridge (used for DTLS authentication)")
 	serverCmd.Flags().StringP("entertainment-zone", "e", "", "Entertainment zone ID for the hue bridge")
-	serverCmd.Flags().IntP("lights", "l", 10, "Number of lights in the entertainment zone (default: 10)")
+	serverCmd.Flags().IntP("lights", "l", 0, "Number of lights in the entertainment zone (default: all channels of the entertainment zone)")
 	serverCmd.Flags().Uint16P("artnet-universe", "n", 0, "Art-Net universe to listen on")
 	serverCmd.Flags().IntP("artnet-dmx-start", "a", 1, "Art-Net DMX start channel")
+	serverCmd.Flags().StringP("profile", "p", "rgb", fmt.Sprintf("Fixture profile of the lights (available: %s)", strings.Join(fixture.Names(), ", ")))
+	serverCmd.Flags().StringSlice("light-profiles", nil, "Fixture profile per light in entertainment channel order, comma separated, empty entries use --profile")
+	serverCmd.Flags().String("dimmer-curve", fixture.CurveLinear, fmt.Sprintf("Dimmer curve of the lights (available: %s) or a lookup table file", strings.Join(fixture.CurveNames(), ", ")))
+	serverCmd.Flags().StringSlice("light-curves", nil, "Dimmer curve per light in entertainment channel order, comma separated, empty entries use --dimmer-curve")
+	serverCmd.Flags().Float64("strobe-max-rate", strobe.DefaultMaxRate, fmt.Sprintf("Maximum strobe flashes per second, 0 disables strobe (at most %g)", strobe.MaxRate))
+	serverCmd.Flags().String("color-mode", hue.ColorModeRGB, "Colour space to stream in, rgb or xy (xy maps colours into the gamut of each light)")
+	serverCmd.Flags().String("gamut-mapping", hue.GamutClip, "How xy mode maps colours a light cannot show, clip (closest colour) or compress (keep hue, reduce saturation)")
+	serverCmd.Flags().String("cct-mix", fixture.CCTAdditive, fmt.Sprintf("How profiles with a colour temperature channel mix its white with the RGB channels (available: %s)", strings.Join(fixture.CCTMixes(), ", ")))
+	serverCmd.Flags().StringSlice("pipeline", pipeline.DefaultStages, fmt.Sprintf("Processing stages in order, comma separated (available: %s)", strings.Join(pipeline.Names(), ", ")))
+	serverCmd.Flags().Float64("smoothing", 0, "Time constant in seconds to fade lights to new colours with the smoothing stage, 0 disables smoothing")
+	serverCmd.Flags().Int("delay", 0, "Delay in milliseconds of all lights, e.g. to line them up with a projector")
+	serverCmd.Flags().IntSlice("light-delays", nil, "Delay in milliseconds per light in entertainment channel order added to --delay, comma separated")
+	serverCmd.Flags().StringArray("park", nil, "Park a light at a fixed colour (<light>:<red>,<green>,<blue>) or its current colour (<light>), can be repeated")
+	serverCmd.Flags().String("http-listen", "", "Address to serve the HTTP API on, e.g. :8080 (default: disabled)")
+	serverCmd.Flags().StringSliceP("inputs", "s", []string{"artnet"}, fmt.Sprintf("Input sources to enable, comma separated (available: %s)", strings.Join(source.Names(), ", ")))
+	serverCmd.Flags().StringSliceP("outputs", "o", []string{"hue"}, fmt.Sprintf("Outputs to send frames to, comma separated (available: %s)", strings.Join(output.Names(), ", ")))
+	serverCmd.Flags().String("record-file", "", "File to write frames to as JSON lines when using the record output")
+	serverCmd.Flags().Int("osc-port", osc.DefaultPort, "UDP port to listen for OSC messages on")
+	serverCmd.Flags().Int("ddp-port", ddp.DefaultPort, "UDP port to listen for DDP pixel data on")
+	serverCmd.Flags().Int("opc-port", opc.DefaultPort, "TCP port to listen for Open Pixel Control clients on")
+	serverCmd.Flags().Int("opc-channel", 1, "OPC channel to accept pixel data for (channel 0 is always accepted as broadcast)")
 	serverCmd.Flags().BoolP("debug", "d", false, "Debug mode (default: false)")
 }
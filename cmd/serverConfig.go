@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	artnetHueConfig "github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/fixture"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"github.com/techwolf12/artnet-to-hue/pkg/park"
+	"github.com/techwolf12/artnet-to-hue/pkg/pipeline"
+	"github.com/techwolf12/artnet-to-hue/pkg/strobe"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// loadServerConfig reads the config file if one is given and overrides it with the flags.
+// Flags that are not set on the command line only fill in values missing from the config file.
+func loadServerConfig(cmd *cobra.Command) (artnetHueConfig.Config, error) {
+	var config artnetHueConfig.Config
+	path, _ := cmd.Flags().GetString("config")
+	if path != "" {
+		var err error
+		config, err = artnetHueConfig.Load(path)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	overlayIP(cmd, "hue-bridge-ip", &config.HueBridgeIP)
+	overlayString(cmd, "username", &config.Username)
+	overlayString(cmd, "client-key", &config.ClientKey)
+	overlayString(cmd, "entertainment-zone", &config.EntertainmentZone)
+	overlayInt(cmd, config, "lights", &config.NumLights)
+	overlayStringSlice(cmd, "inputs", &config.Inputs)
+	overlayStringSlice(cmd, "outputs", &config.Outputs)
+	overlayString(cmd, "record-file", &config.RecordFile)
+	if cmd.Flags().Changed("artnet-universe") {
+		config.ArtNetUniverse, _ = cmd.Flags().GetUint16("artnet-universe")
+	}
+	overlayInt(cmd, config, "artnet-dmx-start", &config.ArtNetStartAddress)
+	overlayString(cmd, "profile", &config.Profile)
+	overlayStringSlice(cmd, "light-profiles", &config.LightProfiles)
+	overlayString(cmd, "dimmer-curve", &config.DimmerCurve)
+	overlayStringSlice(cmd, "light-curves", &config.LightCurves)
+	overlayFloat(cmd, "strobe-max-rate", &config.StrobeMaxRate)
+	overlayString(cmd, "cct-mix", &config.CCTMix)
+	// The pipeline of the entertainment zone takes precedence over the pipeline of the config file,
+	// but not over the flag
+	if stages, ok := config.ZonePipelines[config.EntertainmentZone]; ok && !cmd.Flags().Changed("pipeline") {
+		config.Pipeline = stages
+	}
+	overlayStringSlice(cmd, "pipeline", &config.Pipeline)
+	overlayInt(cmd, config, "delay", &config.Delay)
+	if cmd.Flags().Changed("light-delays") || len(config.LightDelays) == 0 {
+		config.LightDelays, _ = cmd.Flags().GetIntSlice("light-delays")
+	}
+	if cmd.Flags().Changed("smoothing") {
+		config.Smoothing, _ = cmd.Flags().GetFloat64("smoothing")
+	}
+	overlayString(cmd, "color-mode", &config.ColorMode)
+	overlayString(cmd, "gamut-mapping", &config.GamutMapping)
+	overlayString(cmd, "http-listen", &config.HTTPListen)
+	if cmd.Flags().Changed("park") {
+		values, _ := cmd.Flags().GetStringArray("park")
+		config.Park = nil
+		for _, value := range values {
+			entry, err := park.ParseFlag(value)
+			if err != nil {
+				return config, err
+			}
+			config.Park = append(config.Park, entry)
+		}
+	}
+	overlayInt(cmd, config, "osc-port", &config.OSCPort)
+	overlayInt(cmd, config, "ddp-port", &config.DDPPort)
+	overlayInt(cmd, config, "opc-port", &config.OPCPort)
+	overlayInt(cmd, config, "opc-channel", &config.OPCChannel)
+	if cmd.Flags().Changed("debug") || !config.Debug {
+		config.Debug, _ = cmd.Flags().GetBool("debug")
+	}
+
+	return config, validateServerConfig(config)
+}
+
+func validateServerConfig(config artnetHueConfig.Config) error {
+	if len(config.Outputs) == 0 {
+		return errors.New("at least one output is required")
+	}
+	// The bridge connection settings are only needed when streaming to Hue
+	if slices.Contains(config.Outputs, "hue") {
+		if config.HueBridgeIP == nil || config.HueBridgeIP.IsUnspecified() {
+			return errors.New("Hue bridge IP address is required")
+		}
+		if config.Username == "" {
+			return errors.New("username for the Hue bridge is required")
+		}
+		if config.ClientKey == "" {
+			return errors.New("client key for the Hue bridge is required")
+		}
+		if config.EntertainmentZone == "" {
+			return errors.New("entertainment zone ID is required")
+		}
+	}
+	if slices.Contains(config.Outputs, "record") && config.RecordFile == "" {
+		return errors.New("a record file is required for the record output")
+	}
+	if config.NumLights < 0 {
+		return errors.New("number of lights in the entertainment zone must be a positive integer")
+	}
+	if config.ArtNetStartAddress < 0 {
+		return errors.New("Art-Net DMX start channel must be a non-negative integer")
+	}
+	if *config.StrobeMaxRate < 0 || *config.StrobeMaxRate > strobe.MaxRate {
+		return fmt.Errorf("strobe max rate must be between 0 and %g flashes per second", strobe.MaxRate)
+	}
+	if !slices.Contains(fixture.CCTMixes(), config.CCTMix) {
+		return fmt.Errorf("cct mix must be one of %s", strings.Join(fixture.CCTMixes(), ", "))
+	}
+	if config.Smoothing < 0 {
+		return errors.New("smoothing must not be negative")
+	}
+	if config.ColorMode != hue.ColorModeRGB && config.ColorMode != hue.ColorModeXY {
+		return fmt.Errorf("color mode must be %s or %s", hue.ColorModeRGB, hue.ColorModeXY)
+	}
+	if config.GamutMapping != hue.GamutClip && config.GamutMapping != hue.GamutCompress {
+		return fmt.Errorf("gamut mapping must be %s or %s", hue.GamutClip, hue.GamutCompress)
+	}
+	if len(config.Inputs) == 0 {
+		return errors.New("at least one input source is required")
+	}
+	if config.OSCPort < 1 || config.OSCPort > 65535 {
+		return errors.New("OSC port must be between 1 and 65535")
+	}
+	if config.DDPPort < 1 || config.DDPPort > 65535 {
+		return errors.New("DDP port must be between 1 and 65535")
+	}
+	if config.OPCPort < 1 || config.OPCPort > 65535 {
+		return errors.New("OPC port must be between 1 and 65535")
+	}
+	if config.OPCChannel < 0 || config.OPCChannel > 255 {
+		return errors.New("OPC channel must be between 0 and 255")
+	}
+	// Settings would silently be ignored without the stage that applies them
+	if !slices.Contains(config.Pipeline, pipeline.StageMaster) && (config.GrandMaster != nil || len(config.Groups) > 0) {
+		return fmt.Errorf("masters require the %s stage in the pipeline", pipeline.StageMaster)
+	}
+	if !slices.Contains(config.Pipeline, pipeline.StageGamma) && hasCurves(config) {
+		return fmt.Errorf("dimmer curves require the %s stage in the pipeline", pipeline.StageGamma)
+	}
+	if !slices.Contains(config.Pipeline, pipeline.StageLatency) && (config.Delay != 0 || slices.ContainsFunc(config.LightDelays, func(d int) bool { return d != 0 })) {
+		return fmt.Errorf("delays require the %s stage in the pipeline", pipeline.StageLatency)
+	}
+	if !slices.Contains(config.Pipeline, pipeline.StagePark) {
+		if len(config.Park) > 0 {
+			return fmt.Errorf("parking lights requires the %s stage in the pipeline", pipeline.StagePark)
+		}
+		if config.HTTPListen != "" {
+			return fmt.Errorf("the HTTP API requires the %s stage in the pipeline", pipeline.StagePark)
+		}
+	}
+	return nil
+}
+
+// hasCurves returns true if any light has a dimmer curve other than linear.
+func hasCurves(config artnetHueConfig.Config) bool {
+	curves := append([]string{config.DimmerCurve}, config.LightCurves...)
+	for _, curve := range config.ProfileCurves {
+		curves = append(curves, curve)
+	}
+	for _, entry := range config.Patch {
+		curves = append(curves, entry.Curve)
+	}
+	return slices.ContainsFunc(curves, func(curve string) bool {
+		return curve != "" && curve != fixture.CurveLinear
+	})
+}
+
+func overlayString(cmd *cobra.Command, name string, value *string) {
+	if cmd.Flags().Changed(name) || *value == "" {
+		*value, _ = cmd.Flags().GetString(name)
+	}
+}
+
+// overlayInt sets value from the flag unless the config file set it, zero is a valid value in the config file.
+func overlayInt(cmd *cobra.Command, config artnetHueConfig.Config, name string, value *int) {
+	if cmd.Flags().Changed(name) || !config.Has(name) {
+		*value, _ = cmd.Flags().GetInt(name)
+	}
+}
+
+// overlayFloat sets value from the flag unless the config file set it, zero is a valid value in the config file.
+func overlayFloat(cmd *cobra.Command, name string, value **float64) {
+	if cmd.Flags().Changed(name) || *value == nil {
+		v, _ := cmd.Flags().GetFloat64(name)
+		*value = &v
+	}
+}
+
+func overlayStringSlice(cmd *cobra.Command, name string, value *[]string) {
+	if cmd.Flags().Changed(name) || len(*value) == 0 {
+		*value, _ = cmd.Flags().GetStringSlice(name)
+	}
+}
+
+func overlayIP(cmd *cobra.Command, name string, value *net.IP) {
+	if cmd.Flags().Changed(name) || *value == nil {
+		*value, _ = cmd.Flags().GetIP(name)
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/techwolf12/artnet-to-hue/pkg/park"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Server is the HTTP API to control the server at runtime.
+//
+// Endpoints:
+//
+//	GET    /api/park           list the parked lights
+//	PUT    /api/park/{light}   park a light, the body {"color": [r, g, b]} is optional, without it the light is frozen
+//	DELETE /api/park/{light}   release a parked light
+type Server struct {
+	http   *http.Server
+	parker *park.Parker
+}
+
+func NewServer(addr string, parker *park.Parker) *Server {
+	s := &Server{parker: parker}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/park", s.listParked)
+	mux.HandleFunc("PUT /api/park/{light}", s.parkLight)
+	mux.HandleFunc("DELETE /api/park/{light}", s.releaseLight)
+	s.http = &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	return s
+}
+
+// Start listens on the address of the server and serves requests in the background.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := s.http.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP API stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.http.Shutdown(ctx)
+}
+
+func (s *Server) listParked(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.parker.Parked())
+}
+
+func (s *Server) parkLight(w http.ResponseWriter, r *http.Request) {
+	light, err := strconv.Atoi(r.PathValue("light"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "light must be a number")
+		return
+	}
+	var body struct {
+		Color *[3]uint8 `json:"color"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if err := s.parker.Park(light, body.Color); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.parker.Parked())
+}
+
+func (s *Server) releaseLight(w http.ResponseWriter, r *http.Request) {
+	light, err := strconv.Atoi(r.PathValue("light"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "light must be a number")
+		return
+	}
+	if !s.parker.Release(light) {
+		writeError(w, http.StatusNotFound, "light is not parked")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.parker.Parked())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write HTTP response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
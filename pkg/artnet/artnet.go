@@ -4,11 +4,13 @@ import (
 	"encoding/binary"
 	"errors"
 	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/fixture"
+	"github.com/techwolf12/artnet-to-hue/pkg/source"
 	"log"
 	"net"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
 
 	"golang.org/x/net/ipv4"
 )
@@ -16,45 +18,37 @@ import (
 const (
 	artnetPort      = 6454
 	artnetHeader    = "Art-Net\x00"
-	maxLights       = 10
 	dmxPacketLength = 512
 	opDmx           = 0x5000
 	opPoll          = 0x2000
 	opPollReply     = 0x2100
+	shortName       = "artnet-to-hue"
+	longName        = "Artnet to Hue Bridge"
 )
 
+func init() {
+	source.Register("artnet", func(config config.Config) (source.Source, error) {
+		return NewListener(config)
+	})
+}
+
+// Listener is an Art-Net input source, it emits the full DMX universe for every ArtDMX packet
+// on one of the universes used by the patch.
 type Listener struct {
-	conn         *net.UDPConn
-	universe     uint16
-	startAddress int
-	numLights    int
-	cb           func([]byte)
-	mu           sync.Mutex
-	config       config.Config
+	*source.Feed
+	conn      *net.UDPConn
+	universes []uint16
+	config    config.Config
 }
 
-func (l *Listener) advertiseNode(shortName, longName string) {
-	buf := make([]byte, 1024)
-	for {
-		n, addr, err := l.conn.ReadFromUDP(buf)
-		if err != nil || n < 10 {
-			continue
-		}
-		if !strings.HasPrefix(string(buf[:8]), artnetHeader) {
-			continue
-		}
-		op := binary.LittleEndian.Uint16(buf[8:10])
-		if op == opPoll {
-			if l.config.Debug {
-				log.Printf("Received ArtPoll from %s", addr)
-			}
-			reply := buildArtPollReply(l.conn.LocalAddr().(*net.UDPAddr), shortName, longName, l.universe)
-			_, err := l.conn.WriteToUDP(reply, addr)
-			if err != nil {
-				log.Printf("Error writing to UDP: %v", err)
-				return
-			}
-		}
+func (l *Listener) replyToPoll(addr *net.UDPAddr) {
+	if l.config.Debug {
+		log.Printf("Received ArtPoll from %s", addr)
+	}
+	reply := buildArtPollReply(l.conn.LocalAddr().(*net.UDPAddr), shortName, longName, l.universes[0])
+	_, err := l.conn.WriteToUDP(reply, addr)
+	if err != nil {
+		log.Printf("Error writing to UDP: %v", err)
 	}
 }
 
@@ -98,90 +92,95 @@ func multicastAddrForUniverse(universe uint16) string {
 }
 
 func NewListener(config config.Config) (*Listener, error) {
-	if config.NumLights < 1 || config.NumLights > maxLights {
-		return nil, errors.New("numLights must be between 1 and 10")
+	if config.NumLights < 1 {
+		return nil, errors.New("numLights must be at least 1")
 	}
-	if config.ArtNetStartAddress < 1 {
-		return nil, errors.New("startAddress out of DMX range, must be between 1 and 512")
+	universes, err := fixture.UsedUniverses(config)
+	if err != nil {
+		return nil, err
 	}
-	if config.ArtNetStartAddress+(4*config.NumLights)-1 > dmxPacketLength {
-		return nil, errors.New("exceeding DMX packet length, (startAddress + 3 * lights) must be <= 512")
+	if len(universes) == 0 {
+		return nil, errors.New("no lights are patched")
 	}
+	return &Listener{
+		Feed:      source.NewFeed("artnet"),
+		universes: universes,
+		config:    config,
+	}, nil
+}
 
+func (l *Listener) Start() error {
 	addr, err := net.ResolveUDPAddr("udp", "0.0.0.0:"+strconv.Itoa(artnetPort))
 	if err != nil {
-		return nil, err
+		return err
 	}
 	conn, err := net.ListenUDP("udp", addr)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	maddr, _ := net.ResolveUDPAddr("udp", multicastAddrForUniverse(config.ArtNetUniverse))
 	p := ipv4.NewPacketConn(conn)
 	ifaces, _ := net.Interfaces()
-	for _, iface := range ifaces {
-		// Only join on interfaces that are up and support multicast
-		if (iface.Flags&net.FlagUp) != 0 && (iface.Flags&net.FlagMulticast) != 0 {
-			_ = p.JoinGroup(&iface, maddr)
+	for _, universe := range l.universes {
+		maddr, _ := net.ResolveUDPAddr("udp", multicastAddrForUniverse(universe))
+		for _, iface := range ifaces {
+			// Only join on interfaces that are up and support multicast
+			if (iface.Flags&net.FlagUp) != 0 && (iface.Flags&net.FlagMulticast) != 0 {
+				_ = p.JoinGroup(&iface, maddr)
+			}
 		}
 	}
 
-	l := &Listener{
-		conn:         conn,
-		universe:     config.ArtNetUniverse,
-		startAddress: config.ArtNetStartAddress,
-		numLights:    config.NumLights * 3, // Each light uses 3 channels (RGB)
-		config:       config,
-	}
+	l.conn = conn
 	go l.listen()
-	go l.advertiseNode("artnet-to-hue", "Artnet to Hue Bridge")
-	return l, nil
+	return nil
 }
 
-func (l *Listener) OnUpdate(cb func([]byte)) {
-	l.mu.Lock()
-	l.cb = cb
-	l.mu.Unlock()
+func (l *Listener) Stop() error {
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.Close()
 }
 
 func (l *Listener) listen() {
+	defer l.Close()
 	buf := make([]byte, 1024)
 	for {
-		n, _, err := l.conn.ReadFromUDP(buf)
+		n, addr, err := l.conn.ReadFromUDP(buf)
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			continue
 		}
-		if n < 18 { // Minimum ArtDMX packet size
+		if n < 10 || !strings.HasPrefix(string(buf[:8]), artnetHeader) {
 			continue
 		}
-		if !strings.HasPrefix(string(buf[:8]), artnetHeader) {
+		l.Packet()
+		op := binary.LittleEndian.Uint16(buf[8:10])
+		if op == opPoll {
+			l.replyToPoll(addr)
 			continue
 		}
-		op := binary.LittleEndian.Uint16(buf[8:10])
 		if op != opDmx {
 			continue
 		}
-		universe := binary.LittleEndian.Uint16(buf[14:16])
-		if universe != l.universe {
+		if n < 18 { // Minimum ArtDMX packet size
+			l.Invalid()
 			continue
 		}
-		length := int(binary.BigEndian.Uint16(buf[16:18]))
-		if length < l.startAddress-1+l.numLights {
+		universe := binary.LittleEndian.Uint16(buf[14:16])
+		if !slices.Contains(l.universes, universe) {
 			continue
 		}
-		dmx := buf[18 : 18+length]
-		start := l.startAddress - 1
-		end := start + l.numLights
-		if end > len(dmx) {
+		length := int(binary.BigEndian.Uint16(buf[16:18]))
+		if length > dmxPacketLength || 18+length > n {
+			l.Invalid()
 			continue
 		}
-		values := make([]byte, l.numLights)
-		copy(values, dmx[start:end])
-		l.mu.Lock()
-		if l.cb != nil {
-			go l.cb(values)
-		}
-		l.mu.Unlock()
+		dmx := make([]byte, dmxPacketLength)
+		copy(dmx, buf[18:18+length])
+		l.Send(source.Frame{Universe: universe, DMX: dmx})
 	}
 }
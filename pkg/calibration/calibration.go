@@ -0,0 +1,162 @@
+package calibration
+
+import (
+	"errors"
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"math"
+	"strings"
+)
+
+var identity = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+// Transform is the colour correction of a single light.
+type Transform struct {
+	matrix     [3][3]float64
+	gains      [3]float64
+	brightness float64
+}
+
+// NewTransform combines the settings of a calibration entry into a transform.
+func NewTransform(c config.Calibration) (Transform, error) {
+	t := Transform{matrix: identity, gains: [3]float64{1, 1, 1}, brightness: 1}
+	if c.Matrix != nil {
+		t.matrix = *c.Matrix
+	}
+	if c.Gains != nil {
+		for i, gain := range c.Gains {
+			if gain < 0 {
+				return Transform{}, errors.New("gains must not be negative")
+			}
+			t.gains[i] = gain
+		}
+	}
+	if c.WhitePoint != nil {
+		r, g, b := hue.XYToRGB(hue.XY{X: c.WhitePoint[0], Y: c.WhitePoint[1]})
+		if r == 0 && g == 0 && b == 0 {
+			return Transform{}, fmt.Errorf("white point %v is not a valid colour", *c.WhitePoint)
+		}
+		t.gains[0] *= r
+		t.gains[1] *= g
+		t.gains[2] *= b
+	}
+	if c.Brightness != nil {
+		if *c.Brightness < 0 {
+			return Transform{}, errors.New("brightness must not be negative")
+		}
+		t.brightness = *c.Brightness
+	}
+	return t, nil
+}
+
+// Apply corrects the colour of a light, the correction is done in linear light.
+func (t Transform) Apply(state hue.EntertainmentLightState) hue.EntertainmentLightState {
+	in := [3]float64{
+		hue.Linearize(float64(state.Red) / 65535),
+		hue.Linearize(float64(state.Green) / 65535),
+		hue.Linearize(float64(state.Blue) / 65535),
+	}
+	var out [3]uint16
+	for i, row := range t.matrix {
+		v := (row[0]*in[0] + row[1]*in[1] + row[2]*in[2]) * t.gains[i] * t.brightness
+		v = math.Max(0, math.Min(1, v))
+		out[i] = uint16(math.Round(hue.Delinearize(v) * 65535))
+	}
+	state.Red, state.Green, state.Blue = out[0], out[1], out[2]
+	return state
+}
+
+// Calibrator applies the calibration of every light.
+type Calibrator struct {
+	transforms []*Transform
+}
+
+// New resolves the calibration entries for every light, channels are needed for entries
+// that select lights by name or model and may be nil otherwise.
+func New(config config.Config, channels []hue.EntertainmentChannel) (*Calibrator, error) {
+	matches, err := Match(config, channels)
+	if err != nil {
+		return nil, err
+	}
+	// Lights sharing an entry share its transform
+	transforms := make([]*Transform, len(config.Calibration))
+	for i, entry := range config.Calibration {
+		transform, err := NewTransform(entry)
+		if err != nil {
+			return nil, fmt.Errorf("calibration entry %d: %w", i+1, err)
+		}
+		transforms[i] = &transform
+	}
+	c := &Calibrator{transforms: make([]*Transform, config.NumLights)}
+	for light, i := range matches {
+		if i >= 0 {
+			c.transforms[light] = transforms[i]
+		}
+	}
+	return c, nil
+}
+
+// Match returns the index of the calibration entry that applies to every light, -1 for lights without one.
+// Entries for a single light take precedence over entries for a model.
+func Match(config config.Config, channels []hue.EntertainmentChannel) ([]int, error) {
+	matches := make([]int, config.NumLights)
+	for light := range matches {
+		matches[light] = -1
+	}
+	var byModel []int
+	for i, entry := range config.Calibration {
+		selectors := 0
+		for _, set := range []bool{entry.Light != 0, entry.Name != "", entry.Model != ""} {
+			if set {
+				selectors++
+			}
+		}
+		if selectors != 1 {
+			return nil, fmt.Errorf("calibration entry %d must select its lights by exactly one of light, name or model", i+1)
+		}
+		if (entry.Name != "" || entry.Model != "") && channels == nil {
+			return nil, fmt.Errorf("calibration entry %d: calibrating by name or model requires the entertainment configuration from the bridge", i+1)
+		}
+		if entry.Model != "" {
+			// Applied after all per light entries so those take precedence
+			byModel = append(byModel, i)
+			continue
+		}
+		light := entry.Light - 1
+		if entry.Name != "" {
+			var err error
+			light, err = hue.LightByName(channels, entry.Name)
+			if err != nil {
+				return nil, fmt.Errorf("calibration entry %d: %w", i+1, err)
+			}
+		}
+		if light < 0 || light >= config.NumLights {
+			return nil, fmt.Errorf("calibration entry %d: light %d out of range, must be between 1 and %d", i+1, entry.Light, config.NumLights)
+		}
+		matches[light] = i
+	}
+	for _, i := range byModel {
+		for light, channel := range channels {
+			if light >= config.NumLights || matches[light] >= 0 {
+				continue
+			}
+			for _, member := range channel.Members {
+				if strings.EqualFold(member.ModelID, config.Calibration[i].Model) {
+					matches[light] = i
+					break
+				}
+			}
+		}
+	}
+	return matches, nil
+}
+
+// Apply calibrates the states in place.
+func (c *Calibrator) Apply(states []hue.EntertainmentLightState) {
+	for i, state := range states {
+		if i < len(c.transforms) && c.transforms[i] != nil {
+			states[i] = c.transforms[i].Apply(state)
+		}
+	}
+}
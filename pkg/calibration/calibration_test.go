@@ -0,0 +1,169 @@
+package calibration
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"math"
+	"slices"
+	"testing"
+)
+
+// testChannels are a lamp and the two segments of a gradient lightstrip.
+var testChannels = []hue.EntertainmentChannel{
+	{ID: 0, Members: []hue.ChannelMember{{DeviceID: "a", Name: "Lamp", ModelID: "LCA001"}}},
+	{ID: 1, Members: []hue.ChannelMember{{DeviceID: "b", Name: "Strip", ModelID: "LCX004"}}},
+	{ID: 2, Members: []hue.ChannelMember{{DeviceID: "b", Name: "Strip", ModelID: "LCX004", Index: 1}}},
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []config.Calibration
+		channels []hue.EntertainmentChannel
+		want     []int
+		wantErr  bool
+	}{
+		{name: "no entries", channels: testChannels, want: []int{-1, -1, -1}},
+		{name: "by light", entries: []config.Calibration{{Light: 2}}, want: []int{-1, 0, -1}},
+		{name: "by name ignoring case", entries: []config.Calibration{{Name: "lamp"}}, channels: testChannels, want: []int{0, -1, -1}},
+		{name: "by model", entries: []config.Calibration{{Model: "LCX004"}}, channels: testChannels, want: []int{-1, 0, 0}},
+		{
+			name:     "light takes precedence over model",
+			entries:  []config.Calibration{{Model: "LCX004"}, {Light: 3}},
+			channels: testChannels,
+			want:     []int{-1, 0, 1},
+		},
+		{
+			name:     "name takes precedence over model",
+			entries:  []config.Calibration{{Model: "LCA001"}, {Name: "Lamp"}},
+			channels: testChannels,
+			want:     []int{1, -1, -1},
+		},
+		{name: "unknown name", entries: []config.Calibration{{Name: "Desk"}}, channels: testChannels, wantErr: true},
+		{name: "ambiguous name", entries: []config.Calibration{{Name: "Strip"}}, channels: testChannels, wantErr: true},
+		{name: "name without the bridge", entries: []config.Calibration{{Name: "Lamp"}}, wantErr: true},
+		{name: "model without the bridge", entries: []config.Calibration{{Model: "LCA001"}}, wantErr: true},
+		{name: "no selector", entries: []config.Calibration{{}}, wantErr: true},
+		{name: "two selectors", entries: []config.Calibration{{Light: 1, Model: "LCA001"}}, channels: testChannels, wantErr: true},
+		{name: "light out of range", entries: []config.Calibration{{Light: 4}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := Match(config.Config{NumLights: 3, Calibration: tt.entries}, tt.channels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(matches, tt.want) {
+				t.Errorf("got %v, want %v", matches, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTransform(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   config.Calibration
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "all settings", entry: config.Calibration{Matrix: &identity, Gains: &[3]float64{1, 0.9, 0.8}, WhitePoint: &[2]float64{0.3127, 0.329}, Brightness: ptr(0.5)}},
+		{name: "negative gain", entry: config.Calibration{Gains: &[3]float64{1, -0.1, 1}}, wantErr: true},
+		{name: "negative brightness", entry: config.Calibration{Brightness: ptr(-1.0)}, wantErr: true},
+		{name: "white point without luminance", entry: config.Calibration{WhitePoint: &[2]float64{0.3, 0}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTransform(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTransformApply(t *testing.T) {
+	state := hue.EntertainmentLightState{Red: 52428, Green: 32768, Blue: 13107, Strobe: 7}
+	r, g, b := linear(state)
+	wr, wg, wb := hue.XYToRGB(hue.XY{X: 0.35, Y: 0.35})
+	tests := []struct {
+		name  string
+		entry config.Calibration
+		// want is the expected colour in linear light.
+		want [3]float64
+	}{
+		{name: "identity", want: [3]float64{r, g, b}},
+		{name: "gains", entry: config.Calibration{Gains: &[3]float64{0.5, 1, 0.25}}, want: [3]float64{r * 0.5, g, b * 0.25}},
+		{
+			name:  "matrix",
+			entry: config.Calibration{Matrix: &[3][3]float64{{0, 1, 0}, {1, 0, 0}, {0.5, 0, 0.5}}},
+			want:  [3]float64{g, r, 0.5*r + 0.5*b},
+		},
+		{name: "white point", entry: config.Calibration{WhitePoint: &[2]float64{0.35, 0.35}}, want: [3]float64{r * wr, g * wg, b * wb}},
+		{name: "brightness", entry: config.Calibration{Brightness: ptr(0.5)}, want: [3]float64{r * 0.5, g * 0.5, b * 0.5}},
+		{name: "clipped", entry: config.Calibration{Gains: &[3]float64{4, 1, 1}}, want: [3]float64{1, g, b}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transform, err := NewTransform(tt.entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := transform.Apply(state)
+			r, g, b := linear(out)
+			got := [3]float64{r, g, b}
+			for i := range got {
+				// 16-bit rounding of the gamma encoded value
+				if math.Abs(got[i]-tt.want[i]) > 1e-4 {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+			if out.Strobe != state.Strobe {
+				t.Errorf("strobe changed to %d", out.Strobe)
+			}
+		})
+	}
+}
+
+func TestCalibratorApply(t *testing.T) {
+	state := hue.EntertainmentLightState{Red: 65535, Green: 65535, Blue: 65535}
+	half := hue.ToUint16(hue.Delinearize(0.5))
+	tests := []struct {
+		name    string
+		entries []config.Calibration
+		want    []hue.EntertainmentLightState
+	}{
+		{name: "no entries", want: []hue.EntertainmentLightState{state, state, state}},
+		{
+			name:    "single light",
+			entries: []config.Calibration{{Light: 1, Brightness: ptr(0.5)}},
+			want:    []hue.EntertainmentLightState{{Red: half, Green: half, Blue: half}, state, state},
+		},
+		{
+			name:    "model shared by lights",
+			entries: []config.Calibration{{Model: "LCX004", Gains: &[3]float64{1, 0, 0}}},
+			want:    []hue.EntertainmentLightState{state, {Red: 65535}, {Red: 65535}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(config.Config{NumLights: 3, Calibration: tt.entries}, testChannels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			states := []hue.EntertainmentLightState{state, state, state}
+			c.Apply(states)
+			if !slices.Equal(states, tt.want) {
+				t.Errorf("got %v, want %v", states, tt.want)
+			}
+		})
+	}
+}
+
+func linear(state hue.EntertainmentLightState) (float64, float64, float64) {
+	return hue.Linearize(float64(state.Red) / 65535), hue.Linearize(float64(state.Green) / 65535), hue.Linearize(float64(state.Blue) / 65535)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -1,14 +1,218 @@
 package config
 
-import "net"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+)
 
+// Config holds the server settings, the JSON keys match the command line flags.
 type Config struct {
-	HueBridgeIP        net.IP
-	Username           string
-	ClientKey          string
-	EntertainmentZone  string
-	NumLights          int
-	ArtNetUniverse     uint16
-	ArtNetStartAddress int
-	Debug              bool
+	HueBridgeIP        net.IP                `json:"hue-bridge-ip"`
+	Username           string                `json:"username"`
+	ClientKey          string                `json:"client-key"`
+	EntertainmentZone  string                `json:"entertainment-zone"`
+	NumLights          int                   `json:"lights"`
+	Inputs             []string              `json:"inputs"`
+	Outputs            []string              `json:"outputs"`
+	RecordFile         string                `json:"record-file"`
+	ArtNetUniverse     uint16                `json:"artnet-universe"`
+	ArtNetStartAddress int                   `json:"artnet-dmx-start"`
+	Profile            string                `json:"profile"`
+	LightProfiles      []string              `json:"light-profiles"`
+	DimmerCurve        string                `json:"dimmer-curve"`
+	LightCurves        []string              `json:"light-curves"`
+	ProfileCurves      map[string]string     `json:"profile-curves"`
+	Patch              []PatchEntry          `json:"patch"`
+	PixelMap           *PixelMap             `json:"pixel-map"`
+	ColorWheel         *ColorWheel           `json:"color-wheel"`
+	Effects            *Effects              `json:"effects"`
+	GrandMaster        *DMXAddress           `json:"grand-master"`
+	Groups             []Group               `json:"groups"`
+	Calibration        []Calibration         `json:"calibration"`
+	Park               []ParkEntry           `json:"park"`
+	HTTPListen         string                `json:"http-listen"`
+	StrobeMaxRate      *float64              `json:"strobe-max-rate"`
+	CCTMix             string                `json:"cct-mix"`
+	ProfileCCTMixes    map[string]string     `json:"profile-cct-mixes"`
+	Pipeline           []string              `json:"pipeline"`
+	ZonePipelines      map[string][]string   `json:"zone-pipelines"`
+	Delay              int                   `json:"delay"`
+	LightDelays        []int                 `json:"light-delays"`
+	Smoothing          float64               `json:"smoothing"`
+	Limiter            *Limiter              `json:"limiter"`
+	BlackLevel         *BlackLevel           `json:"black-level"`
+	ProfileBlackLevels map[string]BlackLevel `json:"profile-black-levels"`
+	ColorMode          string                `json:"color-mode"`
+	GamutMapping       string                `json:"gamut-mapping"`
+	OSCPort            int                   `json:"osc-port"`
+	DDPPort            int                   `json:"ddp-port"`
+	OPCPort            int                   `json:"opc-port"`
+	OPCChannel         int                   `json:"opc-channel"`
+	Debug              bool                  `json:"debug"`
+
+	// keys holds the keys set in the config file.
+	keys map[string]bool
+}
+
+// PatchEntry assigns a DMX address to a single light, or to all segments of a device.
+// The light is selected by exactly one of Light, Channel, Name or Device.
+type PatchEntry struct {
+	// Light is the 1-based light number in entertainment channel order.
+	Light int `json:"light,omitempty"`
+	// Channel is the entertainment channel ID as reported by the bridge.
+	Channel *int `json:"channel,omitempty"`
+	// Name is the name of the light in the Hue app.
+	Name string `json:"name,omitempty"`
+	// Device is the name or ID of a device with several segments, e.g. a gradient lightstrip.
+	// The segments are patched one after another in segment order.
+	Device string `json:"device,omitempty"`
+	// Reverse patches the segments of a device from the last segment to the first.
+	Reverse bool `json:"reverse,omitempty"`
+	// SingleColor patches all segments of a device to the same address.
+	SingleColor bool   `json:"single-color,omitempty"`
+	Universe    uint16 `json:"universe"`
+	Address     int    `json:"address"`
+	// Profile is the fixture profile, empty uses the default profile.
+	Profile string `json:"profile"`
+	// Curve is the dimmer curve or lookup table file, empty uses the curve of the profile or the default curve.
+	Curve string `json:"curve,omitempty"`
+}
+
+// PixelMap is an RGB pixel matrix that lights without a patch entry are sampled from at their position in the room.
+type PixelMap struct {
+	Universe uint16 `json:"universe"`
+	Address  int    `json:"address"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	// Plane is the plane of the room the matrix covers, xy (floor plan) or xz (front view).
+	Plane string `json:"plane"`
+}
+
+// ColorWheel configures the colour wheel channel of fixture profiles.
+type ColorWheel struct {
+	// Palette are the colours of the wheel in DMX order.
+	Palette []PaletteColor `json:"palette"`
+	// SpinStart is the first DMX value that spins the wheel, 0 uses 128 and 256 disables spinning.
+	SpinStart int `json:"spin-start"`
+}
+
+// PaletteColor is a colour of the colour wheel. Without a DMX range the values below the spin start
+// are divided evenly over the palette.
+type PaletteColor struct {
+	Name  string   `json:"name,omitempty"`
+	Color [3]uint8 `json:"color"`
+	From  *int     `json:"from,omitempty"`
+	To    *int     `json:"to,omitempty"`
+}
+
+// Effects selects a built-in effect, either in the config or from DMX control channels.
+type Effects struct {
+	// Effect is the name of the effect when there are no control channels.
+	Effect string `json:"effect"`
+	// Speed, Size, Intensity and Direction range from 0.0 to 1.0, Speed and Size default to 0.5 and Intensity to 1.
+	Speed     *float64 `json:"speed,omitempty"`
+	Size      *float64 `json:"size,omitempty"`
+	Intensity *float64 `json:"intensity,omitempty"`
+	Direction *float64 `json:"direction,omitempty"`
+	// Color is the colour of effects that use one, white by default.
+	Color *[3]uint8 `json:"color,omitempty"`
+	// Origin is the x and y position pulses and sweeps start from, the listening position (0, 0) by default.
+	Origin *[2]float64 `json:"origin,omitempty"`
+	// Control is the first of the DMX channels selecting the effect and its parameters, which replace the settings above.
+	Control *DMXAddress `json:"control,omitempty"`
+	// ControlChannels is the number of control channels, 7 by default or 8 to add the direction channel.
+	ControlChannels int `json:"control-channels,omitempty"`
+}
+
+// DMXAddress is a single DMX channel.
+type DMXAddress struct {
+	Universe uint16 `json:"universe"`
+	Address  int    `json:"address"`
+}
+
+// Group is a named set of lights with an optional submaster channel.
+type Group struct {
+	Name string `json:"name"`
+	// Lights are 1-based light numbers in entertainment channel order.
+	Lights []int `json:"lights"`
+	// Master is the submaster channel scaling the intensity of the lights in the group.
+	Master *DMXAddress `json:"master,omitempty"`
+}
+
+// Calibration corrects the colour of a single light, or of all lights of a model.
+// Entries for a light take precedence over entries for its model.
+type Calibration struct {
+	// Light is the 1-based light number in entertainment channel order.
+	Light int `json:"light,omitempty"`
+	// Name is the name of the light in the Hue app.
+	Name string `json:"name,omitempty"`
+	// Model is the model ID of the light, e.g. LCT015.
+	Model string `json:"model,omitempty"`
+	// Matrix is applied to the linear red, green and blue values, rows produce red, green and blue.
+	Matrix *[3][3]float64 `json:"matrix,omitempty"`
+	// Gains scale the linear red, green and blue values.
+	Gains *[3]float64 `json:"gains,omitempty"`
+	// WhitePoint is the CIE xy colour full white is shifted to.
+	WhitePoint *[2]float64 `json:"white-point,omitempty"`
+	// Brightness scales the intensity of the light.
+	Brightness *float64 `json:"brightness,omitempty"`
+}
+
+// ParkEntry pins a light to a fixed colour, or to the colour of its first frame if Color is nil.
+// The light is selected by exactly one of Light or Name.
+type ParkEntry struct {
+	// Light is the 1-based light number in entertainment channel order.
+	Light int `json:"light,omitempty"`
+	// Name is the name of the light in the Hue app.
+	Name  string    `json:"name,omitempty"`
+	Color *[3]uint8 `json:"color,omitempty"`
+}
+
+// Limiter caps the brightness of the lights, both limits range from 0.0 to 1.0 and default to 1.
+type Limiter struct {
+	// Max is the highest brightness of a single light.
+	Max *float64 `json:"max,omitempty"`
+	// Average is the highest mean brightness of all lights in the zone.
+	Average *float64 `json:"average,omitempty"`
+}
+
+// BlackLevel handles the lowest brightness of a lamp, all values range from 0.0 to 1.0.
+type BlackLevel struct {
+	// Off is the brightness below which the light is turned off.
+	Off float64 `json:"off"`
+	// Min is the brightness of the light just above Off, the range above Off is remapped to start at Min.
+	Min float64 `json:"min"`
+	// Hysteresis is how far a light that is off must go above Off to turn on again.
+	Hysteresis float64 `json:"hysteresis"`
+}
+
+// Load reads a JSON config file.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var config Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	config.keys = make(map[string]bool, len(keys))
+	for key := range keys {
+		config.keys[key] = true
+	}
+	return config, nil
+}
+
+// Has returns true if the config file sets key, also when it sets it to the zero value.
+func (c Config) Has(key string) bool {
+	return c.keys[key]
 }
@@ -0,0 +1,245 @@
+package ddp
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"github.com/techwolf12/artnet-to-hue/pkg/source"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+)
+
+const (
+	DefaultPort = 4048
+
+	headerLength         = 10
+	timecodeHeaderLength = 14
+
+	flagPush     = 0x01
+	flagQuery    = 0x02
+	flagReply    = 0x04
+	flagStorage  = 0x08
+	flagTimecode = 0x10
+	versionMask  = 0xc0
+	version1     = 0x40
+
+	dataTypeUndefined = 0
+	dataTypeRGB       = 1
+	dataTypeRGBW      = 3
+	dataSizeUndefined = 0
+	dataSize8Bit      = 3
+
+	destinationDisplay = 1
+	destinationAll     = 255
+)
+
+type Packet struct {
+	Flags       byte
+	Push        bool
+	Sequence    byte
+	DataType    byte
+	Destination byte
+	Offset      uint32
+	// Timecode is the 16.16 fixed point presentation time, only valid if HasTimecode is set.
+	Timecode    uint32
+	HasTimecode bool
+	Data        []byte
+}
+
+// Parse decodes a DDP packet.
+func Parse(b []byte) (Packet, error) {
+	if len(b) < headerLength {
+		return Packet{}, errors.New("DDP packet too short")
+	}
+	flags := b[0]
+	if flags&versionMask != version1 {
+		return Packet{}, errors.New("unsupported DDP version")
+	}
+	p := Packet{
+		Flags:       flags,
+		Push:        flags&flagPush != 0,
+		Sequence:    b[1] & 0x0f,
+		DataType:    b[2],
+		Destination: b[3],
+		Offset:      binary.BigEndian.Uint32(b[4:8]),
+	}
+	length := int(binary.BigEndian.Uint16(b[8:10]))
+	start := headerLength
+	if flags&flagTimecode != 0 {
+		if len(b) < timecodeHeaderLength {
+			return Packet{}, errors.New("DDP packet too short for timecode")
+		}
+		p.Timecode = binary.BigEndian.Uint32(b[10:14])
+		p.HasTimecode = true
+		start = timecodeHeaderLength
+	}
+	if start+length > len(b) {
+		return Packet{}, errors.New("DDP data length exceeds packet")
+	}
+	p.Data = b[start : start+length]
+	return p, nil
+}
+
+// bytesPerPixel returns the pixel size for a DDP data type, or 0 if it is unsupported.
+func bytesPerPixel(dataType byte) int {
+	kind := (dataType >> 3) & 0x07
+	size := dataType & 0x07
+	// Without a type the data is 8-bit RGB whatever the size bits say. Many senders (e.g. xLights and LedFx)
+	// send the legacy data type 0x01, which has no type and a pixel size of 1, for 8-bit RGB.
+	if kind == dataTypeUndefined {
+		return 3
+	}
+	if size != dataSizeUndefined && size != dataSize8Bit {
+		return 0
+	}
+	switch kind {
+	case dataTypeRGB:
+		return 3
+	case dataTypeRGBW:
+		return 4
+	}
+	return 0
+}
+
+func init() {
+	source.Register("ddp", func(config config.Config) (source.Source, error) {
+		return NewServer(config)
+	})
+}
+
+// Server receives DDP pixel data over UDP and maps pixel n onto entertainment light n.
+type Server struct {
+	*source.Feed
+	conn         *net.UDPConn
+	pixels       []byte
+	lastTimecode uint32
+	hasTimecode  bool
+	// unsupported holds the data types that were logged as unsupported, each is only logged once.
+	unsupported map[byte]bool
+	mu          sync.Mutex
+	config      config.Config
+}
+
+func NewServer(config config.Config) (*Server, error) {
+	if config.DDPPort < 1 || config.DDPPort > 65535 {
+		return nil, errors.New("DDP port must be between 1 and 65535")
+	}
+	return &Server{
+		Feed:        source.NewFeed("ddp"),
+		pixels:      make([]byte, config.NumLights*3),
+		unsupported: make(map[byte]bool),
+		config:      config,
+	}, nil
+}
+
+func (s *Server) Start() error {
+	addr, err := net.ResolveUDPAddr("udp", "0.0.0.0:"+strconv.Itoa(s.config.DDPPort))
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	go s.listen()
+	return nil
+}
+
+func (s *Server) Stop() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *Server) listen() {
+	defer s.Close()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		s.Packet()
+		packet, err := Parse(buf[:n])
+		if err != nil {
+			s.Invalid()
+			if s.config.Debug {
+				log.Printf("Invalid DDP packet from %s: %v", addr, err)
+			}
+			continue
+		}
+		if packet.Flags&(flagQuery|flagReply|flagStorage) != 0 {
+			// Queries, replies and storage requests are not supported, only display data is
+			continue
+		}
+		if packet.Destination != destinationDisplay && packet.Destination != destinationAll {
+			continue
+		}
+		s.handle(packet)
+	}
+}
+
+func (s *Server) handle(packet Packet) {
+	s.mu.Lock()
+	bpp := bytesPerPixel(packet.DataType)
+	if bpp == 0 {
+		logged := s.unsupported[packet.DataType]
+		s.unsupported[packet.DataType] = true
+		s.mu.Unlock()
+		if !logged {
+			log.Printf("Ignoring DDP packets with unsupported data type 0x%02x", packet.DataType)
+		}
+		return
+	}
+	s.write(packet.Offset, packet.Data, bpp)
+	if !packet.Push {
+		s.mu.Unlock()
+		return
+	}
+	if packet.HasTimecode {
+		// Drop pushes that arrive after a newer frame was already shown
+		if s.hasTimecode && int32(packet.Timecode-s.lastTimecode) < 0 {
+			s.mu.Unlock()
+			return
+		}
+		s.lastTimecode = packet.Timecode
+		s.hasTimecode = true
+	}
+	states := make([]hue.EntertainmentLightState, len(s.pixels)/3)
+	for i := range states {
+		states[i] = hue.RGB8(s.pixels[i*3], s.pixels[i*3+1], s.pixels[i*3+2])
+	}
+	s.mu.Unlock()
+	s.Send(source.Frame{Lights: states})
+}
+
+// write copies pixel data at a byte offset into the RGB pixel buffer, it must be called with the lock held.
+func (s *Server) write(offset uint32, data []byte, bpp int) {
+	if bpp == 3 {
+		if int64(offset) >= int64(len(s.pixels)) {
+			return
+		}
+		copy(s.pixels[offset:], data)
+		return
+	}
+	// RGBW data, offsets count in source bytes and white is added to each colour
+	firstPixel := int64(offset) / int64(bpp)
+	for i := 0; i+bpp <= len(data); i += bpp {
+		pixel := firstPixel + int64(i/bpp)
+		if pixel*3+3 > int64(len(s.pixels)) {
+			return
+		}
+		w := int(data[i+3])
+		for c := 0; c < 3; c++ {
+			s.pixels[pixel*3+int64(c)] = byte(min(int(data[i+c])+w, 255))
+		}
+	}
+}
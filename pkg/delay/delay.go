@@ -0,0 +1,158 @@
+package delay
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"github.com/techwolf12/artnet-to-hue/pkg/pipeline"
+	"slices"
+	"time"
+)
+
+const (
+	// MaxDelay is the longest delay of a light, zone and light delay combined.
+	MaxDelay = 5 * time.Second
+	// renderInterval is how often the pipeline renders frames on the timer, the frames of delayed
+	// lights can be that much older than the last frame.
+	renderInterval = time.Second / hue.LightUpdateRate
+)
+
+// Delays returns the delay of every light, the zone delay plus the delay of the light.
+// It returns nil if no light is delayed.
+func Delays(config config.Config) ([]time.Duration, error) {
+	if config.Delay < 0 {
+		return nil, fmt.Errorf("delay must not be negative")
+	}
+	if len(config.LightDelays) > config.NumLights {
+		return nil, fmt.Errorf("%d light delays given for %d lights", len(config.LightDelays), config.NumLights)
+	}
+	delays := make([]time.Duration, config.NumLights)
+	delayed := false
+	for i := range delays {
+		ms := config.Delay
+		if i < len(config.LightDelays) {
+			if config.LightDelays[i] < 0 {
+				return nil, fmt.Errorf("delay of light %d must not be negative", i+1)
+			}
+			ms += config.LightDelays[i]
+		}
+		delays[i] = time.Duration(ms) * time.Millisecond
+		if delays[i] > MaxDelay {
+			return nil, fmt.Errorf("delay of light %d is %v, at most %v is supported", i+1, delays[i], MaxDelay)
+		}
+		delayed = delayed || ms > 0
+	}
+	if !delayed {
+		return nil, nil
+	}
+	return delays, nil
+}
+
+// Delay is the latency stage of the pipeline, it holds back every light by its own delay, e.g. to make up for
+// the latency of other lights in the rig. Frames are kept with the time they were processed for as long as the
+// longest delay, every light shows the newest frame that is older than its delay. Delayed lights are written
+// with the next frame, frames are rendered on the timer while a light has not caught up.
+type Delay struct {
+	delays []time.Duration
+	// keep is how long frames are kept, the longest delay plus a render interval.
+	keep time.Duration
+
+	// frames holds the frames from oldest to newest, the oldest is frame number first.
+	frames []frame
+	first  uint64
+	// shown holds the number of the frame every light was last written with, 0 before its first frame.
+	shown  []uint64
+	states []hue.EntertainmentLightState
+}
+
+type frame struct {
+	time   time.Time
+	states []hue.EntertainmentLightState
+}
+
+// New creates the latency stage with the delays of every light as returned by Delays, without delays
+// it leaves frames unchanged.
+func New(delays []time.Duration) *Delay {
+	d := &Delay{
+		delays: delays,
+		first:  1,
+		shown:  make([]uint64, len(delays)),
+		states: make([]hue.EntertainmentLightState, len(delays)),
+	}
+	if len(delays) > 0 {
+		d.keep = slices.Max(delays) + renderInterval
+	}
+	return d
+}
+
+func (d *Delay) Name() string {
+	return pipeline.StageLatency
+}
+
+// Process stores the states of the frame and replaces them with the delayed state of every light.
+func (d *Delay) Process(frame *pipeline.Frame) {
+	if d.delays == nil {
+		return
+	}
+	d.write(frame.States, frame.Time)
+	frame.States = d.render(frame.Time)
+}
+
+// Animating returns true while a light does not show the newest frame yet.
+func (d *Delay) Animating() bool {
+	newest := d.first + uint64(len(d.frames)) - 1
+	for _, n := range d.shown {
+		if n < newest {
+			return true
+		}
+	}
+	return false
+}
+
+// write adds a frame and drops the frames no light can show anymore. A frame is dropped once the frame
+// after it is older than the longest delay, so the buffer grows with the frame rate and never loses a
+// frame that is still due. Frames rendered on the timer repeat the last states and are not added.
+func (d *Delay) write(states []hue.EntertainmentLightState, now time.Time) {
+	if n := len(d.frames); n > 0 {
+		if slices.Equal(d.frames[n-1].states, states) {
+			return
+		}
+		// Frames rendered on the timer can carry a time before the last frame
+		if now.Before(d.frames[n-1].time) {
+			now = d.frames[n-1].time
+		}
+	}
+	drop := 0
+	for drop+1 < len(d.frames) && !d.frames[drop+1].time.After(now.Add(-d.keep)) {
+		drop++
+	}
+	d.frames = slices.Delete(d.frames, 0, drop)
+	d.first += uint64(drop)
+	d.frames = append(d.frames, frame{time: now, states: slices.Clone(states)})
+}
+
+// render sets every light to the newest frame that is older than its delay.
+func (d *Delay) render(now time.Time) []hue.EntertainmentLightState {
+	for light, delay := range d.delays {
+		n := d.due(now.Add(-delay))
+		if n == 0 || n == d.shown[light] {
+			continue
+		}
+		d.shown[light] = n
+		f := d.frames[n-d.first]
+		if light < len(f.states) {
+			d.states[light] = f.states[light]
+		}
+	}
+	return slices.Clone(d.states)
+}
+
+// due returns the number of the newest frame written at or before t, 0 if there is none.
+func (d *Delay) due(t time.Time) uint64 {
+	for i := len(d.frames) - 1; i >= 0; i-- {
+		if !d.frames[i].time.After(t) {
+			return d.first + uint64(i)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,156 @@
+package delay
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"github.com/techwolf12/artnet-to-hue/pkg/pipeline"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDelays(t *testing.T) {
+	tests := []struct {
+		name        string
+		delay       int
+		lightDelays []int
+		want        []time.Duration
+		wantErr     bool
+	}{
+		{name: "no delays"},
+		{name: "all light delays zero", lightDelays: []int{0, 0}},
+		{name: "zone delay", delay: 100, want: []time.Duration{100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond}},
+		{name: "light delays add to the zone delay", delay: 100, lightDelays: []int{0, 50}, want: []time.Duration{100 * time.Millisecond, 150 * time.Millisecond, 100 * time.Millisecond}},
+		{name: "negative zone delay", delay: -1, wantErr: true},
+		{name: "negative light delay", lightDelays: []int{0, -1}, wantErr: true},
+		{name: "more light delays than lights", lightDelays: []int{1, 2, 3, 4}, wantErr: true},
+		{name: "above the maximum", delay: 4000, lightDelays: []int{0, 0, 1001}, wantErr: true},
+		{name: "at the maximum", delay: 5000, want: []time.Duration{MaxDelay, MaxDelay, MaxDelay}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delays, err := Delays(config.Config{NumLights: 3, Delay: tt.delay, LightDelays: tt.lightDelays})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(delays, tt.want) {
+				t.Errorf("got %v, want %v", delays, tt.want)
+			}
+		})
+	}
+}
+
+func TestDue(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name  string
+		delay time.Duration
+		// writes are the times the frames are written at, after start.
+		writes []time.Duration
+		at     time.Duration
+		want   uint64
+	}{
+		{name: "no frames", delay: time.Second, at: time.Second},
+		{name: "before the first frame", delay: time.Second, writes: []time.Duration{time.Second}, at: 0},
+		{name: "at a frame", delay: time.Second, writes: []time.Duration{0, time.Second}, at: time.Second, want: 2},
+		{name: "between frames", delay: time.Second, writes: []time.Duration{0, time.Second, 2 * time.Second}, at: 1500 * time.Millisecond, want: 2},
+		{
+			name:   "high frame rates keep the due frame",
+			delay:  MaxDelay,
+			writes: every(time.Millisecond, 10*time.Second),
+			at:     10*time.Second - MaxDelay,
+			want:   10001 - uint64(MaxDelay/time.Millisecond),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New([]time.Duration{tt.delay})
+			for i, w := range tt.writes {
+				d.write([]hue.EntertainmentLightState{{Red: uint16(i)}}, start.Add(w))
+			}
+			if got := d.due(start.Add(tt.at)); got != tt.want {
+				t.Errorf("got frame %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcess(t *testing.T) {
+	start := time.Unix(1000, 0)
+	red := hue.EntertainmentLightState{Red: 65535}
+	blue := hue.EntertainmentLightState{Blue: 65535}
+	// step is a frame with states, or a frame rendered on the timer without new states.
+	type step struct {
+		at     time.Duration
+		states []hue.EntertainmentLightState
+	}
+	tests := []struct {
+		name          string
+		delays        []time.Duration
+		steps         []step
+		want          []hue.EntertainmentLightState
+		wantAnimating bool
+	}{
+		{
+			name:  "no delays",
+			steps: []step{{states: []hue.EntertainmentLightState{red, blue}}},
+			want:  []hue.EntertainmentLightState{red, blue},
+		},
+		{
+			name:          "delayed light is black before its first frame",
+			delays:        []time.Duration{0, time.Second},
+			steps:         []step{{states: []hue.EntertainmentLightState{red, blue}}},
+			want:          []hue.EntertainmentLightState{red, {}},
+			wantAnimating: true,
+		},
+		{
+			name:   "delayed light catches up on the timer",
+			delays: []time.Duration{0, time.Second},
+			steps: []step{
+				{states: []hue.EntertainmentLightState{red, blue}},
+				{at: time.Second},
+			},
+			want: []hue.EntertainmentLightState{red, blue},
+		},
+		{
+			name:   "every light shows its own frame",
+			delays: []time.Duration{0, time.Second},
+			steps: []step{
+				{states: []hue.EntertainmentLightState{red, red}},
+				{at: 1500 * time.Millisecond, states: []hue.EntertainmentLightState{blue, blue}},
+			},
+			want:          []hue.EntertainmentLightState{blue, red},
+			wantAnimating: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(tt.delays)
+			var frame pipeline.Frame
+			for _, s := range tt.steps {
+				states := s.states
+				if states == nil {
+					// Rendered frames repeat the last input
+					states = slices.Clone(tt.steps[0].states)
+				}
+				frame = pipeline.Frame{Time: start.Add(s.at), States: states}
+				d.Process(&frame)
+			}
+			if !slices.Equal(frame.States, tt.want) {
+				t.Errorf("got %v, want %v", frame.States, tt.want)
+			}
+			if got := d.Animating(); got != tt.wantAnimating {
+				t.Errorf("got animating %v, want %v", got, tt.wantAnimating)
+			}
+		})
+	}
+}
+
+// every returns the times from 0 up to and including end in steps of step.
+func every(step, end time.Duration) []time.Duration {
+	var times []time.Duration
+	for t := time.Duration(0); t <= end; t += step {
+		times = append(times, t)
+	}
+	return times
+}
@@ -0,0 +1,431 @@
+package effect
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"math"
+	"time"
+)
+
+const (
+	// ControlChannels is the number of DMX channels controlling an effect:
+	// effect, speed, size, red, green, blue and intensity.
+	ControlChannels = 7
+	// DirectionControlChannels is the number of control channels with the direction channel after intensity.
+	DirectionControlChannels = 8
+)
+
+// Params are the settings of the running effect, all values except Origin range from 0.0 to 1.0.
+type Params struct {
+	Speed     float64
+	Size      float64
+	Color     [3]float64
+	Intensity float64
+	// Direction is the angle of a wipe, or for pulses and sweeps below 0.5 outwards and clockwise.
+	Direction float64
+	// Origin is the x and y position pulses and sweeps start from, the listening position by default.
+	Origin [2]float64
+}
+
+// Off is the effect name that stops the effect.
+const Off = "off"
+
+// Settings selects an effect and changes its parameters, an empty Effect keeps the current effect
+// and nil parameters keep their current value.
+type Settings struct {
+	Effect    string
+	Speed     *float64
+	Size      *float64
+	Color     *[3]float64
+	Intensity *float64
+	Direction *float64
+	Origin    *[2]float64
+}
+
+// Light is the light an effect renders.
+type Light struct {
+	// Index is the 0-based light index, Count the number of lights in the zone.
+	Index, Count int
+	// Position is the position of the light in the room, from -1 to 1 on every axis.
+	Position hue.Position
+}
+
+// renderFunc renders one light at t seconds since the engine started.
+type renderFunc func(p Params, light Light, t float64) [3]float64
+
+type effect struct {
+	name   string
+	render renderFunc
+}
+
+// effects in the order of their DMX ranges.
+var effects = []effect{
+	{"rainbow", rainbow},
+	{"chase", chase},
+	{"breathe", breathe},
+	{"fire", fire},
+	{"lightning", lightning},
+	{"color-cycle", colorCycle},
+	{"sparkle", sparkle},
+	{"wipe", wipe},
+	{"pulse", pulse},
+	{"sweep", sweep},
+}
+
+// dmxSlot is the width of the DMX range selecting each effect, values below the first slot select no effect.
+const dmxSlot = 10
+
+// DefaultParams are used for parameters that are not set.
+var DefaultParams = Params{Speed: 0.5, Size: 0.5, Color: [3]float64{1, 1, 1}, Intensity: 1}
+
+// Names returns the names of all effects in DMX order.
+func Names() []string {
+	names := make([]string, len(effects))
+	for i, e := range effects {
+		names[i] = e.name
+	}
+	return names
+}
+
+func lookup(name string) (renderFunc, error) {
+	for _, e := range effects {
+		if e.name == name {
+			return e.render, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown effect %q, available: %v", name, Names())
+}
+
+// Engine renders the effect selected in the config, by its DMX control channels or over OSC.
+// The last change wins, DMX control channels only take over when their values change.
+type Engine struct {
+	start   time.Time
+	control *config.DMXAddress
+	// footprint is the number of control channels, ControlChannels or DirectionControlChannels.
+	footprint int
+	// last holds the values of the control channels the effect was last set from.
+	last      [DirectionControlChannels]byte
+	current   renderFunc
+	params    Params
+	positions []hue.Position
+}
+
+// New creates the effects engine, without an effect in the config no effect runs until one is selected.
+func New(config config.Config) (*Engine, error) {
+	e := &Engine{start: time.Now(), params: DefaultParams}
+	c := config.Effects
+	if c == nil {
+		return e, nil
+	}
+	if c.Control != nil {
+		e.footprint = ControlChannels
+		if c.ControlChannels != 0 {
+			e.footprint = c.ControlChannels
+		}
+		if e.footprint != ControlChannels && e.footprint != DirectionControlChannels {
+			return nil, fmt.Errorf("effect control channels must be %d or %d with the direction channel", ControlChannels, DirectionControlChannels)
+		}
+		if c.Control.Address < 1 || c.Control.Address+e.footprint-1 > 512 {
+			return nil, fmt.Errorf("effect control address %d out of DMX range, must be between 1 and %d", c.Control.Address, 512-e.footprint+1)
+		}
+		e.control = c.Control
+	}
+	if c.Effect != "" {
+		var err error
+		e.current, err = lookup(c.Effect)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range []struct {
+		name  string
+		value *float64
+		to    *float64
+	}{{"speed", c.Speed, &e.params.Speed}, {"size", c.Size, &e.params.Size}, {"intensity", c.Intensity, &e.params.Intensity}, {"direction", c.Direction, &e.params.Direction}} {
+		if v.value == nil {
+			continue
+		}
+		if *v.value < 0 || *v.value > 1 {
+			return nil, fmt.Errorf("effect %s must be between 0 and 1", v.name)
+		}
+		*v.to = *v.value
+	}
+	if c.Color != nil {
+		e.params.Color = colorParam(c.Color[0], c.Color[1], c.Color[2])
+	}
+	if c.Origin != nil {
+		for _, v := range c.Origin {
+			if v < -1 || v > 1 {
+				return nil, fmt.Errorf("effect origin must be between -1 and 1")
+			}
+		}
+		e.params.Origin = *c.Origin
+	}
+	return e, nil
+}
+
+// Place sets the positions of the lights from the entertainment channels. Without positions
+// the lights are spread from left to right in light order.
+func (e *Engine) Place(channels []hue.EntertainmentChannel) {
+	e.positions = make([]hue.Position, len(channels))
+	for i, channel := range channels {
+		e.positions[i] = channel.Position
+	}
+}
+
+// Set selects the effect and changes the parameters that are set, the others keep their current value.
+func (e *Engine) Set(settings Settings) error {
+	switch settings.Effect {
+	case "":
+	case Off:
+		e.current = nil
+	default:
+		render, err := lookup(settings.Effect)
+		if err != nil {
+			return err
+		}
+		e.current = render
+	}
+	for _, v := range []struct {
+		value *float64
+		to    *float64
+	}{{settings.Speed, &e.params.Speed}, {settings.Size, &e.params.Size}, {settings.Intensity, &e.params.Intensity}, {settings.Direction, &e.params.Direction}} {
+		if v.value != nil {
+			*v.to = *v.value
+		}
+	}
+	if settings.Color != nil {
+		e.params.Color = *settings.Color
+	}
+	if settings.Origin != nil {
+		e.params.Origin = *settings.Origin
+	}
+	return nil
+}
+
+// colorParam converts an 8-bit colour, black means white so effects are visible without setting a colour.
+func colorParam(r, g, b byte) [3]float64 {
+	if r == 0 && g == 0 && b == 0 {
+		return [3]float64{1, 1, 1}
+	}
+	return [3]float64{float64(r) / 255, float64(g) / 255, float64(b) / 255}
+}
+
+// Universe returns the universe of the DMX control channels and false if the effect is set in the config.
+func (e *Engine) Universe() (uint16, bool) {
+	if e == nil || e.control == nil {
+		return 0, false
+	}
+	return e.control.Universe, true
+}
+
+// Control reads the effect and its parameters from the DMX data of the control universe.
+func (e *Engine) Control(dmx []byte) {
+	if e == nil || e.control == nil {
+		return
+	}
+	var channels [DirectionControlChannels]byte
+	copy(channels[:], dmx[e.control.Address-1:e.control.Address-1+e.footprint])
+	if channels == e.last {
+		return
+	}
+	e.last = channels
+	e.current = nil
+	if slot := int(channels[0])/dmxSlot - 1; slot >= 0 && slot < len(effects) {
+		e.current = effects[slot].render
+	}
+	// Without the direction channel the direction stays as set in the config or over OSC
+	direction := e.params.Direction
+	if e.footprint == DirectionControlChannels {
+		direction = float64(channels[7]) / 255
+	}
+	e.params = Params{
+		Speed:     float64(channels[1]) / 255,
+		Size:      float64(channels[2]) / 255,
+		Color:     colorParam(channels[3], channels[4], channels[5]),
+		Intensity: float64(channels[6]) / 255,
+		Direction: direction,
+		Origin:    e.params.Origin,
+	}
+}
+
+// Active returns true if an effect is running.
+func (e *Engine) Active() bool {
+	return e != nil && e.current != nil && e.params.Intensity > 0
+}
+
+// Render returns the effect colour of every light at the given time, all lights are off without an effect.
+func (e *Engine) Render(now time.Time, numLights int) []hue.EntertainmentLightState {
+	states := make([]hue.EntertainmentLightState, numLights)
+	if !e.Active() {
+		return states
+	}
+	t := now.Sub(e.start).Seconds()
+	for i := range states {
+		light := Light{Index: i, Count: numLights}
+		if i < len(e.positions) {
+			light.Position = e.positions[i]
+		} else {
+			light.Position.X = 2*position(light) - 1
+		}
+		rgb := e.current(e.params, light, t)
+		states[i] = hue.EntertainmentLightState{
+			Red:   hue.ToUint16(rgb[0] * e.params.Intensity),
+			Green: hue.ToUint16(rgb[1] * e.params.Intensity),
+			Blue:  hue.ToUint16(rgb[2] * e.params.Intensity),
+		}
+	}
+	return states
+}
+
+// rate converts the speed parameter into cycles per second, from one cycle per 20 seconds to 4 per second.
+func rate(speed float64) float64 {
+	return 0.05 * math.Pow(80, speed)
+}
+
+// position returns the position of a light along the zone (0.0-1.0).
+func position(light Light) float64 {
+	if light.Count <= 1 {
+		return 0
+	}
+	return float64(light.Index) / float64(light.Count)
+}
+
+func rainbow(p Params, light Light, t float64) [3]float64 {
+	// Size is how much of the rainbow is spread over the lights
+	r, g, b := hue.HSVToRGB(frac(t*rate(p.Speed)+position(light)*p.Size), 1, 1)
+	return [3]float64{r, g, b}
+}
+
+func chase(p Params, light Light, t float64) [3]float64 {
+	head := frac(t * rate(p.Speed))
+	width := math.Max(p.Size, 1/float64(max(light.Count, 1)))
+	// Distance behind the head, wrapping around the zone
+	behind := frac(head - position(light))
+	if behind >= width {
+		return [3]float64{}
+	}
+	// Lights fade out towards the tail
+	return scaled(p.Color, 1-behind/width)
+}
+
+func breathe(p Params, light Light, t float64) [3]float64 {
+	// Size offsets the lights so the breath rolls through the zone
+	phase := t*rate(p.Speed) - position(light)*p.Size
+	return scaled(p.Color, (1-math.Cos(2*math.Pi*phase))/2)
+}
+
+func fire(p Params, light Light, t float64) [3]float64 {
+	// Faster speeds flicker faster, size lowers the flames
+	flicker := noise(light.Index, t*(2+rate(p.Speed)*5))
+	heat := 0.35 + 0.65*flicker*(1-p.Size*0.5)
+	// Hotter flames are more yellow
+	return [3]float64{heat, heat * heat * 0.6, heat * heat * heat * 0.1}
+}
+
+func lightning(p Params, light Light, t float64) [3]float64 {
+	// A chance of a strike in every slot, speed makes strikes more frequent
+	slotLength := 1 / (0.2 + rate(p.Speed))
+	slot := math.Floor(t / slotLength)
+	if hash(int(slot), -1) > 0.35 {
+		return [3]float64{}
+	}
+	// Size is the share of lights hit by a strike
+	if hash(int(slot), light.Index) > math.Max(p.Size, 0.1) {
+		return [3]float64{}
+	}
+	elapsed := t - slot*slotLength
+	// A bright flash with a quick decay and a flicker
+	level := math.Exp(-elapsed*12) * (0.6 + 0.4*hash(int(t*30), light.Index))
+	return scaled(p.Color, level)
+}
+
+func colorCycle(p Params, light Light, t float64) [3]float64 {
+	// All lights change colour together, size softens the saturation
+	r, g, b := hue.HSVToRGB(frac(t*rate(p.Speed)), 1-p.Size*0.6, 1)
+	return [3]float64{r, g, b}
+}
+
+func sparkle(p Params, light Light, t float64) [3]float64 {
+	// Every light gets its own sparkle slots so sparkles don't line up
+	slotLength := 1 / (0.5 + rate(p.Speed)*2)
+	shifted := t + hash(light.Index, -2)*slotLength
+	slot := math.Floor(shifted / slotLength)
+	// Size is the share of lights sparkling in a slot
+	if hash(int(slot), light.Index) > math.Max(p.Size, 0.05) {
+		return [3]float64{}
+	}
+	elapsed := (shifted - slot*slotLength) / slotLength
+	return scaled(p.Color, math.Exp(-elapsed*6))
+}
+
+func wipe(p Params, light Light, t float64) [3]float64 {
+	// Direction 0 wipes from the front to the back, higher values turn the wipe clockwise
+	angle := p.Direction * 2 * math.Pi
+	along := light.Position.X*math.Sin(angle) - light.Position.Y*math.Cos(angle)
+	// Positions along the wipe range from -sqrt(2) to sqrt(2) in the corners of the room
+	s := (along + math.Sqrt2) / (2 * math.Sqrt2)
+	behind := frac(frac(t*rate(p.Speed)) - s)
+	width := math.Max(p.Size, 0.05)
+	if behind >= width {
+		return [3]float64{}
+	}
+	return scaled(p.Color, 1-behind/width)
+}
+
+func pulse(p Params, light Light, t float64) [3]float64 {
+	// Rings travel outwards from the origin, or inwards from the walls for directions from 0.5
+	distance := math.Hypot(light.Position.X-p.Origin[0], light.Position.Y-p.Origin[1])
+	// The furthest corner is at most 2*sqrt(2) away from an origin in the room
+	s := distance / (2 * math.Sqrt2)
+	if p.Direction >= 0.5 {
+		s = 1 - s
+	}
+	behind := frac(frac(t*rate(p.Speed)) - s)
+	width := math.Max(p.Size, 0.05)
+	if behind >= width {
+		return [3]float64{}
+	}
+	return scaled(p.Color, 1-behind/width)
+}
+
+func sweep(p Params, light Light, t float64) [3]float64 {
+	// A beam rotating around the origin, clockwise seen from above for directions below 0.5
+	angle := math.Atan2(light.Position.X-p.Origin[0], light.Position.Y-p.Origin[1]) / (2 * math.Pi)
+	beam := frac(t * rate(p.Speed))
+	behind := frac(beam - angle)
+	if p.Direction >= 0.5 {
+		behind = frac(angle + beam)
+	}
+	// Size is the length of the tail behind the beam
+	width := math.Max(p.Size, 0.05)
+	if behind >= width {
+		return [3]float64{}
+	}
+	return scaled(p.Color, 1-behind/width)
+}
+
+func scaled(color [3]float64, level float64) [3]float64 {
+	return [3]float64{color[0] * level, color[1] * level, color[2] * level}
+}
+
+func frac(v float64) float64 {
+	return v - math.Floor(v)
+}
+
+// hash returns a pseudo random value (0.0-1.0) that is the same for the same inputs.
+func hash(a, b int) float64 {
+	h := uint32(a)*374761393 + uint32(b)*668265263
+	h = (h ^ (h >> 13)) * 1274126177
+	h ^= h >> 16
+	return float64(h) / math.MaxUint32
+}
+
+// noise returns smooth value noise (0.0-1.0) over time, different for every light.
+func noise(light int, t float64) float64 {
+	i := math.Floor(t)
+	f := t - i
+	f = f * f * (3 - 2*f)
+	return hash(int(i), light)*(1-f) + hash(int(i)+1, light)*f
+}
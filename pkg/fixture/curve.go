@@ -0,0 +1,146 @@
+package fixture
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CurveLinear is the default dimmer curve, DMX values map to the same intensity.
+const CurveLinear = "linear"
+
+// Curve maps the intensity of a light (0-65535) to the intensity sent to Hue.
+type Curve struct {
+	Name string
+	// table holds 256 or 65536 entries, 256 entry tables are interpolated.
+	table []uint16
+}
+
+var curves = map[string]func(float64) float64{
+	CurveLinear: func(v float64) float64 { return v },
+	// square follows the square-law of incandescent dimmers, more resolution at the bottom of the fader
+	"square": func(v float64) float64 { return v * v },
+	"s-curve": func(v float64) float64 {
+		return v * v * (3 - 2*v)
+	},
+	"inverse-square": math.Sqrt,
+}
+
+// CurveNames returns the names of all built-in curves.
+func CurveNames() []string {
+	names := make([]string, 0, len(curves))
+	for name := range curves {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupCurve returns the built-in curve with the given name, any other value is read as a lookup table file.
+func LookupCurve(name string) (*Curve, error) {
+	if name == "" {
+		name = CurveLinear
+	}
+	f, ok := curves[name]
+	if !ok {
+		if _, err := os.Stat(name); err != nil {
+			return nil, fmt.Errorf("unknown dimmer curve %q, available: %v or a lookup table file", name, CurveNames())
+		}
+		return LoadCurve(name)
+	}
+	table := make([]uint16, 65536)
+	for i := range table {
+		table[i] = hue.ToUint16(f(float64(i) / 65535))
+	}
+	return &Curve{Name: name, table: table}, nil
+}
+
+// LoadCurve reads a lookup table file with 256 (8-bit, 0-255) or 65536 (16-bit, 0-65535) entries.
+// Entries are separated by whitespace or commas, lines starting with # are ignored.
+func LoadCurve(path string) (*Curve, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			log.Printf("Failed to close lookup table: %v", err)
+		}
+	}(file)
+
+	var values []int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			v, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("lookup table %s: invalid entry %q", path, field)
+			}
+			values = append(values, v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("lookup table %s: %w", path, err)
+	}
+
+	maxValue := 0
+	switch len(values) {
+	case 256:
+		maxValue = 255
+	case 65536:
+		maxValue = 65535
+	default:
+		return nil, fmt.Errorf("lookup table %s has %d entries, must have 256 or 65536", path, len(values))
+	}
+	table := make([]uint16, len(values))
+	for i, v := range values {
+		if v < 0 || v > maxValue {
+			return nil, fmt.Errorf("lookup table %s: entry %d out of range, must be between 0 and %d", path, i+1, maxValue)
+		}
+		table[i] = uint16(v * 65535 / maxValue)
+	}
+	return &Curve{Name: path, table: table}, nil
+}
+
+// Map returns the output intensity for an input intensity.
+func (c *Curve) Map(v uint16) uint16 {
+	if len(c.table) == 65536 {
+		return c.table[v]
+	}
+	// Interpolate between the 256 entries of an 8-bit table
+	pos := float64(v) / 65535 * 255
+	i := int(pos)
+	if i >= 255 {
+		return c.table[255]
+	}
+	frac := pos - float64(i)
+	return uint16(math.Round(float64(c.table[i])*(1-frac) + float64(c.table[i+1])*frac))
+}
+
+// Apply maps the intensity of a light, the brightest colour component, through the curve and scales
+// all components by the same amount so the colour stays the same.
+func (c *Curve) Apply(state hue.EntertainmentLightState) hue.EntertainmentLightState {
+	if c == nil || c.Name == CurveLinear {
+		return state
+	}
+	brightest := max(state.Red, state.Green, state.Blue)
+	if brightest == 0 {
+		return state
+	}
+	scale := float64(c.Map(brightest)) / float64(brightest)
+	state.Red = hue.ToUint16(float64(state.Red) * scale / 65535)
+	state.Green = hue.ToUint16(float64(state.Green) * scale / 65535)
+	state.Blue = hue.ToUint16(float64(state.Blue) * scale / 65535)
+	return state
+}
@@ -0,0 +1,227 @@
+package fixture
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"slices"
+	"sort"
+	"time"
+)
+
+type Channel int
+
+const (
+	Red Channel = iota
+	Green
+	Blue
+	White
+	Amber
+	Dimmer
+	Strobe
+	ColorTemperature
+	Hue
+	Saturation
+	Intensity
+	RedFine
+	GreenFine
+	BlueFine
+	WhiteFine
+	DimmerFine
+	ColorWheel
+
+	numChannels
+)
+
+// fineChannels maps each coarse channel to the channel holding its low byte in 16-bit profiles.
+var fineChannels = map[Channel]Channel{
+	Red:    RedFine,
+	Green:  GreenFine,
+	Blue:   BlueFine,
+	White:  WhiteFine,
+	Dimmer: DimmerFine,
+}
+
+const (
+	minColorTemperature = 2000
+	maxColorTemperature = 6500
+)
+
+// How profiles with a colour temperature channel mix its white with the RGB channels. The white channel
+// sets the level of the colour temperature white, profiles without one show it at full level.
+const (
+	// CCTOnly shows the colour temperature white only, the RGB channels are ignored.
+	CCTOnly = "cct-only"
+	// CCTAdditive adds the colour temperature white to the RGB colour, like the white LEDs of an RGBW fixture.
+	CCTAdditive = "additive"
+	// CCTWhitePriority fades the RGB colour out as the white level goes up, full white is a pure black-body white.
+	CCTWhitePriority = "white-priority"
+)
+
+// CCTMixes returns the names of all colour temperature mixing modes.
+func CCTMixes() []string {
+	return []string{CCTOnly, CCTAdditive, CCTWhitePriority}
+}
+
+// Profile describes the DMX channel layout of a single light.
+type Profile struct {
+	Name     string
+	Channels []Channel
+	// CCTMix is how the colour temperature white is mixed with the RGB channels, empty is additive.
+	CCTMix string
+}
+
+var profiles = map[string]Profile{
+	"rgb":     {Name: "rgb", Channels: []Channel{Red, Green, Blue}},
+	"rgbw":    {Name: "rgbw", Channels: []Channel{Red, Green, Blue, White}},
+	"rgba":    {Name: "rgba", Channels: []Channel{Red, Green, Blue, Amber}},
+	"drgb":    {Name: "drgb", Channels: []Channel{Dimmer, Red, Green, Blue}},
+	"drgbs":   {Name: "drgbs", Channels: []Channel{Dimmer, Red, Green, Blue, Strobe}},
+	"cct":     {Name: "cct", Channels: []Channel{Dimmer, ColorTemperature}},
+	"rgbwcct": {Name: "rgbwcct", Channels: []Channel{Red, Green, Blue, White, ColorTemperature}},
+	"hsi":     {Name: "hsi", Channels: []Channel{Hue, Saturation, Intensity}},
+	"wheel":   {Name: "wheel", Channels: []Channel{Dimmer, ColorWheel}},
+
+	"rgb16":  {Name: "rgb16", Channels: []Channel{Red, RedFine, Green, GreenFine, Blue, BlueFine}},
+	"rgbw16": {Name: "rgbw16", Channels: []Channel{Red, RedFine, Green, GreenFine, Blue, BlueFine, White, WhiteFine}},
+	"drgb16": {Name: "drgb16", Channels: []Channel{Dimmer, DimmerFine, Red, RedFine, Green, GreenFine, Blue, BlueFine}},
+}
+
+// Lookup returns the profile with the given name.
+func Lookup(name string) (Profile, error) {
+	profile, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown fixture profile %q, available: %v", name, Names())
+	}
+	return profile, nil
+}
+
+// Names returns the names of all built-in profiles.
+func Names() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForLights returns the profile of every light, lights without an entry in LightProfiles use Profile.
+func ForLights(config config.Config) ([]Profile, error) {
+	if len(config.LightProfiles) > config.NumLights {
+		return nil, fmt.Errorf("%d light profiles given for %d lights", len(config.LightProfiles), config.NumLights)
+	}
+	result := make([]Profile, config.NumLights)
+	for i := range result {
+		name := config.Profile
+		if i < len(config.LightProfiles) && config.LightProfiles[i] != "" {
+			name = config.LightProfiles[i]
+		}
+		profile, err := Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = profile
+	}
+	return result, nil
+}
+
+// Footprint returns the total number of DMX channels used by the profiles.
+func Footprint(profiles []Profile) int {
+	total := 0
+	for _, profile := range profiles {
+		total += profile.Footprint()
+	}
+	return total
+}
+
+// HasChannel returns true if the profile has the given channel.
+func (p Profile) HasChannel(channel Channel) bool {
+	return slices.Contains(p.Channels, channel)
+}
+
+// Footprint returns the number of DMX channels used by the profile.
+func (p Profile) Footprint() int {
+	return len(p.Channels)
+}
+
+// Decode converts the DMX values of a single light, starting at its first channel, into a light state.
+// Profiles with a colour wheel channel need the wheel state of the light, now is used to spin the wheel.
+func (p Profile) Decode(dmx []byte, wheel *WheelState, now time.Time) hue.EntertainmentLightState {
+	var raw [numChannels]byte
+	var values [numChannels]float64
+	var present [numChannels]bool
+	for i, channel := range p.Channels {
+		raw[channel] = dmx[i]
+		values[channel] = float64(dmx[i]) / 255
+		present[channel] = true
+	}
+	for coarse, fine := range fineChannels {
+		if present[coarse] && present[fine] {
+			values[coarse] = float64(uint16(raw[coarse])<<8|uint16(raw[fine])) / 65535
+		}
+	}
+
+	r, g, b := values[Red], values[Green], values[Blue]
+	switch {
+	case present[Hue]:
+		r, g, b = hue.HSVToRGB(values[Hue], values[Saturation], values[Intensity])
+	case present[ColorTemperature]:
+		level := 1.0
+		if present[White] {
+			level = values[White]
+		}
+		kelvin := minColorTemperature + values[ColorTemperature]*(maxColorTemperature-minColorTemperature)
+		r, g, b = p.mixWhite(r, g, b, kelvin, level)
+	case present[ColorWheel] && wheel != nil:
+		r, g, b = wheel.Color(raw[ColorWheel], now)
+	}
+	// The white channel of colour temperature profiles sets the level of the colour temperature white
+	if present[White] && !present[ColorTemperature] {
+		r, g, b = r+values[White], g+values[White], b+values[White]
+	}
+	if present[Amber] {
+		// Amber is roughly 255, 191, 0
+		r, g = r+values[Amber], g+values[Amber]*0.75
+	}
+	if present[Dimmer] {
+		r, g, b = r*values[Dimmer], g*values[Dimmer], b*values[Dimmer]
+	}
+
+	state := hue.EntertainmentLightState{
+		Red:   hue.ToUint16(r),
+		Green: hue.ToUint16(g),
+		Blue:  hue.ToUint16(b),
+	}
+	if present[Strobe] {
+		state.Strobe = int(raw[Strobe])
+	}
+	return state
+}
+
+// mixWhite mixes the black-body white at the given temperature and level (0.0-1.0) with an RGB colour.
+// Light adds up linearly, so the colours are mixed in linear light.
+func (p Profile) mixWhite(r, g, b, kelvin, level float64) (float64, float64, float64) {
+	wr, wg, wb := hue.XYToRGB(hue.PlanckianXY(kelvin))
+	w := hue.Linearize(level)
+	rgb := [3]float64{hue.Linearize(r), hue.Linearize(g), hue.Linearize(b)}
+	white := [3]float64{wr * w, wg * w, wb * w}
+	var mixed [3]float64
+	for i := range mixed {
+		switch p.CCTMix {
+		case CCTOnly:
+			mixed[i] = white[i]
+		case CCTWhitePriority:
+			mixed[i] = rgb[i]*(1-w) + white[i]
+		default:
+			mixed[i] = rgb[i] + white[i]
+		}
+	}
+	// Scale bright mixes down instead of clipping them, clipping would shift the colour
+	if brightest := max(mixed[0], mixed[1], mixed[2]); brightest > 1 {
+		for i := range mixed {
+			mixed[i] /= brightest
+		}
+	}
+	return hue.Delinearize(mixed[0]), hue.Delinearize(mixed[1]), hue.Delinearize(mixed[2])
+}
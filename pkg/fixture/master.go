@@ -0,0 +1,114 @@
+package fixture
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"math"
+)
+
+// Masters scales the intensity of lights by the grand master and the submasters of their groups.
+type Masters struct {
+	grand *masterChannel
+	// submasters holds the submaster channels of the groups of every light.
+	submasters [][]masterChannel
+}
+
+type masterChannel struct {
+	universe uint16
+	address  int
+}
+
+// NewMasters resolves the master channels, it returns nil if no master channels are configured.
+func NewMasters(config config.Config) (*Masters, error) {
+	m := &Masters{submasters: make([][]masterChannel, config.NumLights)}
+	configured := false
+	if config.GrandMaster != nil {
+		if err := validateMaster(config.GrandMaster.Address); err != nil {
+			return nil, fmt.Errorf("grand master: %w", err)
+		}
+		m.grand = &masterChannel{universe: config.GrandMaster.Universe, address: config.GrandMaster.Address}
+		configured = true
+	}
+	names := make(map[string]bool)
+	for i, group := range config.Groups {
+		if group.Name == "" {
+			return nil, fmt.Errorf("group %d has no name", i+1)
+		}
+		if names[group.Name] {
+			return nil, fmt.Errorf("group %q is defined more than once", group.Name)
+		}
+		names[group.Name] = true
+		for _, light := range group.Lights {
+			if light < 1 || light > config.NumLights {
+				return nil, fmt.Errorf("group %q: light %d out of range, must be between 1 and %d", group.Name, light, config.NumLights)
+			}
+		}
+		if group.Master == nil {
+			continue
+		}
+		if err := validateMaster(group.Master.Address); err != nil {
+			return nil, fmt.Errorf("group %q: %w", group.Name, err)
+		}
+		submaster := masterChannel{universe: group.Master.Universe, address: group.Master.Address}
+		for _, light := range group.Lights {
+			m.submasters[light-1] = append(m.submasters[light-1], submaster)
+		}
+		configured = true
+	}
+	if !configured {
+		return nil, nil
+	}
+	return m, nil
+}
+
+func validateMaster(address int) error {
+	if address < 1 || address > dmxUniverseSize {
+		return fmt.Errorf("address %d out of DMX range, must be between 1 and %d", address, dmxUniverseSize)
+	}
+	return nil
+}
+
+// Universes returns the universes of all master channels.
+func (m *Masters) Universes() []uint16 {
+	if m == nil {
+		return nil
+	}
+	var universes []uint16
+	if m.grand != nil {
+		universes = append(universes, m.grand.universe)
+	}
+	for _, submasters := range m.submasters {
+		for _, submaster := range submasters {
+			universes = append(universes, submaster.universe)
+		}
+	}
+	return universes
+}
+
+// Level returns the combined level (0.0-1.0) of the grand master and the submasters of a light.
+// A light in several groups is scaled by all of their submasters.
+func (m *Masters) Level(light int, universes map[uint16][]byte) float64 {
+	if m == nil {
+		return 1
+	}
+	level := 1.0
+	if m.grand != nil {
+		level *= float64(universes[m.grand.universe][m.grand.address-1]) / 255
+	}
+	for _, submaster := range m.submasters[light] {
+		level *= float64(universes[submaster.universe][submaster.address-1]) / 255
+	}
+	return level
+}
+
+// scale multiplies the intensity of a light by level.
+func scale(state hue.EntertainmentLightState, level float64) hue.EntertainmentLightState {
+	if level >= 1 {
+		return state
+	}
+	state.Red = uint16(math.Round(float64(state.Red) * level))
+	state.Green = uint16(math.Round(float64(state.Green) * level))
+	state.Blue = uint16(math.Round(float64(state.Blue) * level))
+	return state
+}
@@ -0,0 +1,495 @@
+package fixture
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/effect"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dmxUniverseSize = 512
+
+// Patched is a light with its DMX address resolved.
+type Patched struct {
+	// Light is the 0-based light index in entertainment channel order.
+	Light    int
+	Universe uint16
+	Address  int
+	Profile  Profile
+	Curve    *Curve
+}
+
+// BuildPatch resolves the patch of all lights. Without a patch table the lights are patched one after
+// another from the start address, with a patch table lights without an entry are left unpatched.
+// With a pixel map and without a patch table no lights are patched, they are all pixel mapped.
+func BuildPatch(config config.Config) ([]Patched, error) {
+	if len(config.Patch) == 0 && config.PixelMap != nil {
+		return nil, nil
+	}
+	if len(config.Patch) == 0 {
+		profiles, err := ForLights(config)
+		if err != nil {
+			return nil, err
+		}
+		patch := make([]Patched, len(profiles))
+		address := config.ArtNetStartAddress
+		for i, profile := range profiles {
+			patch[i] = Patched{Light: i, Universe: config.ArtNetUniverse, Address: address, Profile: profile}
+			address += profile.Footprint()
+		}
+		if err := assignCurves(config, patch); err != nil {
+			return nil, err
+		}
+		return patch, validatePatch(patch)
+	}
+
+	seen := make(map[int]bool)
+	patch := make([]Patched, 0, len(config.Patch))
+	for _, entry := range config.Patch {
+		if entry.Channel != nil || entry.Name != "" || entry.Device != "" {
+			return nil, fmt.Errorf("patching by channel, name or device requires the entertainment configuration from the bridge")
+		}
+		if entry.Light < 1 || entry.Light > config.NumLights {
+			return nil, fmt.Errorf("patched light %d out of range, must be between 1 and %d", entry.Light, config.NumLights)
+		}
+		if seen[entry.Light] {
+			return nil, fmt.Errorf("light %d is patched more than once", entry.Light)
+		}
+		seen[entry.Light] = true
+		name := entry.Profile
+		if name == "" {
+			name = config.Profile
+		}
+		profile, err := Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("light %d: %w", entry.Light, err)
+		}
+		patch = append(patch, Patched{Light: entry.Light - 1, Universe: entry.Universe, Address: entry.Address, Profile: profile})
+	}
+	if err := assignCurves(config, patch); err != nil {
+		return nil, err
+	}
+	return patch, validatePatch(patch)
+}
+
+// assignCurves sets the dimmer curve of every patched light. The curve of the patch entry or LightCurves
+// takes precedence over ProfileCurves, which takes precedence over DimmerCurve.
+func assignCurves(config config.Config, patch []Patched) error {
+	if len(config.LightCurves) > config.NumLights {
+		return fmt.Errorf("%d light curves given for %d lights", len(config.LightCurves), config.NumLights)
+	}
+	entryCurves := make(map[int]string)
+	for _, entry := range config.Patch {
+		if entry.Curve != "" {
+			entryCurves[entry.Light-1] = entry.Curve
+		}
+	}
+	// Lights sharing a curve or lookup table file share a single table
+	loaded := make(map[string]*Curve)
+	for i, p := range patch {
+		name := config.DimmerCurve
+		if profileCurve, ok := config.ProfileCurves[p.Profile.Name]; ok {
+			name = profileCurve
+		}
+		if p.Light < len(config.LightCurves) && config.LightCurves[p.Light] != "" {
+			name = config.LightCurves[p.Light]
+		}
+		if entryCurve, ok := entryCurves[p.Light]; ok {
+			name = entryCurve
+		}
+		curve, ok := loaded[name]
+		if !ok {
+			var err error
+			curve, err = LookupCurve(name)
+			if err != nil {
+				return fmt.Errorf("light %d: %w", p.Light+1, err)
+			}
+			loaded[name] = curve
+		}
+		patch[i].Curve = curve
+	}
+	return nil
+}
+
+func validatePatch(patch []Patched) error {
+	for _, p := range patch {
+		if p.Address < 1 || p.Address > dmxUniverseSize {
+			return fmt.Errorf("light %d: address %d out of DMX range, must be between 1 and %d", p.Light+1, p.Address, dmxUniverseSize)
+		}
+		if p.Address+p.Profile.Footprint()-1 > dmxUniverseSize {
+			return fmt.Errorf("light %d: exceeding DMX packet length, (address + footprint - 1) must be <= %d", p.Light+1, dmxUniverseSize)
+		}
+	}
+	return nil
+}
+
+// ResolvePatch returns a copy of the patch table with entries that select their light by
+// channel ID or name replaced by the light number of that channel. Device entries are expanded
+// into an entry per segment, profile is the default profile used to lay out the segments.
+func ResolvePatch(entries []config.PatchEntry, profile string, channels []hue.EntertainmentChannel) ([]config.PatchEntry, error) {
+	resolved := make([]config.PatchEntry, 0, len(entries))
+	for i, entry := range entries {
+		selectors := 0
+		for _, set := range []bool{entry.Light != 0, entry.Channel != nil, entry.Name != "", entry.Device != ""} {
+			if set {
+				selectors++
+			}
+		}
+		if selectors != 1 {
+			return nil, fmt.Errorf("patch entry %d must select its light by exactly one of light, channel, name or device", i+1)
+		}
+		if entry.Device == "" && (entry.Reverse || entry.SingleColor) {
+			return nil, fmt.Errorf("patch entry %d: reverse and single-color only apply to devices", i+1)
+		}
+		switch {
+		case entry.Channel != nil:
+			light := -1
+			for n, channel := range channels {
+				if int(channel.ID) == *entry.Channel {
+					light = n
+				}
+			}
+			if light < 0 {
+				return nil, fmt.Errorf("patch entry %d: channel %d not found in the entertainment configuration", i+1, *entry.Channel)
+			}
+			entry.Light = light + 1
+		case entry.Name != "":
+			light, err := hue.LightByName(channels, entry.Name)
+			if err != nil {
+				return nil, fmt.Errorf("patch entry %d: %w", i+1, err)
+			}
+			entry.Light = light + 1
+		case entry.Device != "":
+			segments, err := expandDevice(entry, profile, channels)
+			if err != nil {
+				return nil, fmt.Errorf("patch entry %d: %w", i+1, err)
+			}
+			resolved = append(resolved, segments...)
+			continue
+		}
+		entry.Channel = nil
+		entry.Name = ""
+		resolved = append(resolved, entry)
+	}
+	return resolved, nil
+}
+
+// expandDevice returns a patch entry for every segment of the device selected by entry.
+func expandDevice(entry config.PatchEntry, defaultProfile string, channels []hue.EntertainmentChannel) ([]config.PatchEntry, error) {
+	var device *hue.Device
+	for _, d := range hue.Devices(channels) {
+		if d.ID == entry.Device || strings.EqualFold(d.Name, entry.Device) {
+			if device != nil {
+				return nil, fmt.Errorf("more than one device named %q, select it by ID instead", entry.Device)
+			}
+			device = &d
+		}
+	}
+	if device == nil {
+		return nil, fmt.Errorf("no device %q in the entertainment configuration", entry.Device)
+	}
+	lights := slices.Clone(device.Lights)
+	if entry.Reverse {
+		slices.Reverse(lights)
+	}
+	name := entry.Profile
+	if name == "" {
+		name = defaultProfile
+	}
+	footprint := 0
+	if !entry.SingleColor {
+		profile, err := Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		footprint = profile.Footprint()
+	}
+	segments := make([]config.PatchEntry, len(lights))
+	for i, light := range lights {
+		segments[i] = config.PatchEntry{
+			Light:    light + 1,
+			Universe: entry.Universe,
+			Address:  entry.Address + i*footprint,
+			Profile:  entry.Profile,
+			Curve:    entry.Curve,
+		}
+	}
+	return segments, nil
+}
+
+// Universes returns the distinct universes used by the patch in ascending order.
+func Universes(patch []Patched) []uint16 {
+	universes := make([]uint16, len(patch))
+	for i, p := range patch {
+		universes[i] = p.Universe
+	}
+	return distinct(universes)
+}
+
+// UsedUniverses returns the distinct universes of the patch, the pixel map and the master and effect
+// control channels in ascending order.
+func UsedUniverses(config config.Config) ([]uint16, error) {
+	patch, err := BuildPatch(config)
+	if err != nil {
+		return nil, err
+	}
+	masters, err := NewMasters(config)
+	if err != nil {
+		return nil, err
+	}
+	pixelMap, err := NewPixelMap(config)
+	if err != nil {
+		return nil, err
+	}
+	effects, err := effect.New(config)
+	if err != nil {
+		return nil, err
+	}
+	universes := append(Universes(patch), masters.Universes()...)
+	universes = append(universes, pixelMap.Universes()...)
+	if universe, ok := effects.Universe(); ok {
+		universes = append(universes, universe)
+	}
+	return distinct(universes), nil
+}
+
+func distinct(universes []uint16) []uint16 {
+	seen := make(map[uint16]bool)
+	var result []uint16
+	for _, universe := range universes {
+		if !seen[universe] {
+			seen[universe] = true
+			result = append(result, universe)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// assignCCTMixes sets the colour temperature mix of every patched light, ProfileCCTMixes takes precedence over CCTMix.
+func assignCCTMixes(config config.Config, patch []Patched) error {
+	for name, mix := range config.ProfileCCTMixes {
+		if _, err := Lookup(name); err != nil {
+			return fmt.Errorf("profile cct mixes: %w", err)
+		}
+		if !slices.Contains(CCTMixes(), mix) {
+			return fmt.Errorf("cct mix of profile %s must be one of %s", name, strings.Join(CCTMixes(), ", "))
+		}
+	}
+	for i, p := range patch {
+		patch[i].Profile.CCTMix = config.CCTMix
+		if mix, ok := config.ProfileCCTMixes[p.Profile.Name]; ok {
+			patch[i].Profile.CCTMix = mix
+		}
+	}
+	return nil
+}
+
+// Decoder keeps the last DMX data of every patched universe and decodes it into light states.
+type Decoder struct {
+	patch   []Patched
+	masters *Masters
+	// wheels holds the colour wheel state of every patched light, nil for profiles without a colour wheel.
+	wheels []*WheelState
+	// pixelMap samples the lights without a patch entry, nil without a pixel map.
+	pixelMap *PixelMap
+	mapped   []int
+	// curves holds the dimmer curve of every light.
+	curves    []*Curve
+	effects   *effect.Engine
+	numLights int
+	universes map[uint16][]byte
+	mu        sync.Mutex
+}
+
+// NewDecoder builds the decoder for the patch of config, channels are needed for pixel mapping and may be nil otherwise.
+func NewDecoder(config config.Config, channels []hue.EntertainmentChannel) (*Decoder, error) {
+	patch, err := BuildPatch(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := assignCCTMixes(config, patch); err != nil {
+		return nil, err
+	}
+	masters, err := NewMasters(config)
+	if err != nil {
+		return nil, err
+	}
+	wheel, err := NewWheel(config)
+	if err != nil {
+		return nil, err
+	}
+	wheels := make([]*WheelState, len(patch))
+	for i, p := range patch {
+		if p.Profile.HasChannel(ColorWheel) {
+			wheels[i] = wheel.NewState()
+		}
+	}
+	d := &Decoder{
+		patch:     patch,
+		masters:   masters,
+		wheels:    wheels,
+		numLights: config.NumLights,
+		universes: make(map[uint16][]byte),
+	}
+
+	// Lights without a patch entry, pixel mapped or set by other inputs, resolve their curve like
+	// patched lights, from LightCurves or the curve of their profile
+	profiles, err := ForLights(config)
+	if err != nil {
+		return nil, err
+	}
+	d.curves = make([]*Curve, config.NumLights)
+	patched := make(map[int]bool)
+	for _, p := range patch {
+		patched[p.Light] = true
+		d.curves[p.Light] = p.Curve
+	}
+	var unpatched []Patched
+	for light := 0; light < config.NumLights; light++ {
+		if !patched[light] {
+			unpatched = append(unpatched, Patched{Light: light, Profile: profiles[light]})
+		}
+	}
+	if err := assignCurves(config, unpatched); err != nil {
+		return nil, err
+	}
+	for _, p := range unpatched {
+		d.curves[p.Light] = p.Curve
+	}
+
+	d.pixelMap, err = NewPixelMap(config)
+	if err != nil {
+		return nil, err
+	}
+	if d.pixelMap != nil {
+		if err := d.pixelMap.Place(channels, config.NumLights); err != nil {
+			return nil, err
+		}
+		for _, p := range unpatched {
+			d.mapped = append(d.mapped, p.Light)
+		}
+	}
+
+	d.effects, err = effect.New(config)
+	if err != nil {
+		return nil, err
+	}
+	d.effects.Place(channels)
+
+	universes, err := UsedUniverses(config)
+	if err != nil {
+		return nil, err
+	}
+	for _, universe := range universes {
+		d.universes[universe] = make([]byte, dmxUniverseSize)
+	}
+	return d, nil
+}
+
+// Decode stores the DMX data of a universe and returns the states of all lights, unpatched lights are off.
+// Masters and dimmer curves are not applied, see Master and Curve.
+// The second return value is false if the universe is not patched.
+func (d *Decoder) Decode(universe uint16, dmx []byte) ([]hue.EntertainmentLightState, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	buf, ok := d.universes[universe]
+	if !ok {
+		return nil, false
+	}
+	copy(buf, dmx)
+	return d.render(time.Now()), true
+}
+
+// Patched returns true if the DMX data of the universe is decoded.
+func (d *Decoder) Patched(universe uint16) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.universes[universe]
+	return ok
+}
+
+// Render decodes the last received DMX data again at the given time, for lights that change over time.
+func (d *Decoder) Render(now time.Time) []hue.EntertainmentLightState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.render(now)
+}
+
+func (d *Decoder) render(now time.Time) []hue.EntertainmentLightState {
+	states := make([]hue.EntertainmentLightState, d.numLights)
+	for i, p := range d.patch {
+		states[p.Light] = p.Profile.Decode(d.universes[p.Universe][p.Address-1:], d.wheels[i], now)
+	}
+	for _, light := range d.mapped {
+		states[light] = d.pixelMap.Sample(light, d.universes)
+	}
+	// The effect is merged with the DMX colours, the highest value of every colour wins
+	if universe, ok := d.effects.Universe(); ok {
+		d.effects.Control(d.universes[universe])
+	}
+	for light, state := range d.effects.Render(now, d.numLights) {
+		states[light].Red = max(states[light].Red, state.Red)
+		states[light].Green = max(states[light].Green, state.Green)
+		states[light].Blue = max(states[light].Blue, state.Blue)
+	}
+	return states
+}
+
+// Master scales the states of all lights by their master channels in place, whether they were set
+// from DMX or from other inputs like OSC.
+func (d *Decoder) Master(states []hue.EntertainmentLightState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for light, state := range states {
+		if light < d.numLights {
+			states[light] = scale(state, d.masters.Level(light, d.universes))
+		}
+	}
+}
+
+// Curve applies the dimmer curve of every light to the states in place.
+func (d *Decoder) Curve(states []hue.EntertainmentLightState) {
+	for light, state := range states {
+		if light < len(d.curves) {
+			states[light] = d.curves[light].Apply(state)
+		}
+	}
+}
+
+// SetEffect selects the built-in effect, e.g. from OSC, and returns the states of all lights.
+func (d *Decoder) SetEffect(settings effect.Settings) ([]hue.EntertainmentLightState, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.effects.Set(settings); err != nil {
+		return nil, err
+	}
+	return d.render(time.Now()), nil
+}
+
+// Animating returns true if a light changes over time without new DMX data, e.g. a spinning colour wheel or an effect.
+func (d *Decoder) Animating() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if universe, ok := d.effects.Universe(); ok {
+		d.effects.Control(d.universes[universe])
+	}
+	if d.effects.Active() {
+		return true
+	}
+	for i, p := range d.patch {
+		if d.wheels[i] == nil {
+			continue
+		}
+		offset := slices.Index(p.Profile.Channels, ColorWheel)
+		if d.wheels[i].wheel.spinning(d.universes[p.Universe][p.Address-1+offset]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package fixture
+
+import (
+	"errors"
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"math"
+)
+
+const (
+	// PlaneXY maps the matrix to the floor plan of the room, the top row is the front (the TV side).
+	PlaneXY = "xy"
+	// PlaneXZ maps the matrix to the front view of the room, the top row is the ceiling.
+	PlaneXZ = "xz"
+
+	bytesPerPixel = 3
+)
+
+// PixelMap samples an RGB pixel matrix at the position of every light in the entertainment zone.
+type PixelMap struct {
+	width, height int
+	plane         string
+	// pixels holds the universe and 0-based DMX offset of every pixel in row-major order.
+	pixels []pixelLocation
+	// points holds the column and row every light is sampled at.
+	points [][2]float64
+}
+
+type pixelLocation struct {
+	universe uint16
+	offset   int
+}
+
+// NewPixelMap lays out the pixel matrix of the config, it returns nil if no pixel map is configured.
+// Pixels are never split over universes, a pixel that does not fit continues at channel 1 of the next universe.
+func NewPixelMap(config config.Config) (*PixelMap, error) {
+	if config.PixelMap == nil {
+		return nil, nil
+	}
+	pm := config.PixelMap
+	if pm.Width < 1 || pm.Height < 1 {
+		return nil, errors.New("pixel map width and height must be at least 1")
+	}
+	if pm.Address < 1 || pm.Address+bytesPerPixel-1 > dmxUniverseSize {
+		return nil, fmt.Errorf("pixel map address %d out of DMX range, must be between 1 and %d", pm.Address, dmxUniverseSize-bytesPerPixel+1)
+	}
+	plane := pm.Plane
+	if plane == "" {
+		plane = PlaneXY
+	}
+	if plane != PlaneXY && plane != PlaneXZ {
+		return nil, fmt.Errorf("pixel map plane must be %s or %s", PlaneXY, PlaneXZ)
+	}
+
+	m := &PixelMap{width: pm.Width, height: pm.Height, plane: plane}
+	universe, offset := pm.Universe, pm.Address-1
+	for i := 0; i < pm.Width*pm.Height; i++ {
+		if offset+bytesPerPixel > dmxUniverseSize {
+			if universe == math.MaxUint16 {
+				return nil, errors.New("pixel map does not fit in the remaining universes")
+			}
+			universe, offset = universe+1, 0
+		}
+		m.pixels = append(m.pixels, pixelLocation{universe: universe, offset: offset})
+		offset += bytesPerPixel
+	}
+	return m, nil
+}
+
+// Place sets the point every light is sampled at from the positions of the entertainment channels.
+func (m *PixelMap) Place(channels []hue.EntertainmentChannel, numLights int) error {
+	if len(channels) < numLights {
+		return errors.New("pixel mapping requires the entertainment configuration from the bridge")
+	}
+	// Positions range from -1 to 1, columns go from left to right
+	m.points = make([][2]float64, numLights)
+	for i := range m.points {
+		position := channels[i].Position
+		vertical := position.Y
+		if m.plane == PlaneXZ {
+			vertical = position.Z
+		}
+		m.points[i] = [2]float64{
+			(clampPosition(position.X) + 1) / 2 * float64(m.width-1),
+			(1 - clampPosition(vertical)) / 2 * float64(m.height-1),
+		}
+	}
+	return nil
+}
+
+func clampPosition(v float64) float64 {
+	return math.Max(-1, math.Min(1, v))
+}
+
+// Universes returns the universes of the pixel matrix.
+func (m *PixelMap) Universes() []uint16 {
+	if m == nil {
+		return nil
+	}
+	var universes []uint16
+	for _, pixel := range m.pixels {
+		if len(universes) == 0 || universes[len(universes)-1] != pixel.universe {
+			universes = append(universes, pixel.universe)
+		}
+	}
+	return universes
+}
+
+// Sample returns the colour of the matrix at the position of a light, interpolated between the four nearest pixels.
+func (m *PixelMap) Sample(light int, universes map[uint16][]byte) hue.EntertainmentLightState {
+	point := m.points[light]
+	x0, y0 := int(point[0]), int(point[1])
+	x1, y1 := min(x0+1, m.width-1), min(y0+1, m.height-1)
+	fx, fy := point[0]-float64(x0), point[1]-float64(y0)
+
+	var rgb [3]float64
+	for c := range rgb {
+		top := m.value(x0, y0, c, universes)*(1-fx) + m.value(x1, y0, c, universes)*fx
+		bottom := m.value(x0, y1, c, universes)*(1-fx) + m.value(x1, y1, c, universes)*fx
+		rgb[c] = top*(1-fy) + bottom*fy
+	}
+	return hue.EntertainmentLightState{Red: hue.ToUint16(rgb[0]), Green: hue.ToUint16(rgb[1]), Blue: hue.ToUint16(rgb[2])}
+}
+
+// value returns colour component c of a pixel (0.0-1.0).
+func (m *PixelMap) value(x, y, c int, universes map[uint16][]byte) float64 {
+	pixel := m.pixels[y*m.width+x]
+	return float64(universes[pixel.universe][pixel.offset+c]) / 255
+}
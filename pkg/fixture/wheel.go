@@ -0,0 +1,151 @@
+package fixture
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"math"
+	"time"
+)
+
+const (
+	// defaultSpinStart is the first DMX value spinning the wheel when the config does not set one.
+	defaultSpinStart = 128
+	// Spin speeds in palette colours per second at the start of the spin range and at 255.
+	minSpinSpeed = 0.2
+	maxSpinSpeed = 5.0
+)
+
+// defaultPalette is used when the config has no colour wheel palette.
+var defaultPalette = [][3]float64{
+	{1, 1, 1},   // White
+	{1, 0, 0},   // Red
+	{1, 0.5, 0}, // Orange
+	{1, 1, 0},   // Yellow
+	{0, 1, 0},   // Green
+	{0, 1, 1},   // Cyan
+	{0, 0, 1},   // Blue
+	{1, 0, 1},   // Magenta
+}
+
+// Wheel maps colour wheel DMX values to the colours of a palette, values from the spin start
+// rotate through the palette.
+type Wheel struct {
+	colors [][3]float64
+	// slots holds the palette index of every DMX value below the spin start, -1 for values without a colour.
+	slots     [256]int
+	spinStart int
+}
+
+// NewWheel builds the colour wheel from the config, without a palette the default palette is used.
+func NewWheel(config config.Config) (*Wheel, error) {
+	w := &Wheel{spinStart: defaultSpinStart}
+	if config.ColorWheel != nil && config.ColorWheel.SpinStart != 0 {
+		w.spinStart = config.ColorWheel.SpinStart
+	}
+	if w.spinStart < 1 || w.spinStart > 256 {
+		return nil, fmt.Errorf("colour wheel spin start must be between 1 and 256")
+	}
+	for i := range w.slots {
+		w.slots[i] = -1
+	}
+
+	if config.ColorWheel == nil || len(config.ColorWheel.Palette) == 0 {
+		w.colors = defaultPalette
+		w.split()
+		return w, nil
+	}
+	palette := config.ColorWheel.Palette
+	ranged := palette[0].From != nil || palette[0].To != nil
+	for i, color := range palette {
+		w.colors = append(w.colors, [3]float64{float64(color.Color[0]) / 255, float64(color.Color[1]) / 255, float64(color.Color[2]) / 255})
+		if (color.From != nil || color.To != nil) != ranged {
+			return nil, fmt.Errorf("colour wheel: either all or none of the palette colours must have a DMX range")
+		}
+		if !ranged {
+			continue
+		}
+		if color.From == nil || color.To == nil {
+			return nil, fmt.Errorf("colour wheel: palette colour %d needs both from and to", i+1)
+		}
+		if *color.From < 0 || *color.From > *color.To || *color.To >= w.spinStart {
+			return nil, fmt.Errorf("colour wheel: palette colour %d range %d-%d must be within 0-%d", i+1, *color.From, *color.To, w.spinStart-1)
+		}
+		for v := *color.From; v <= *color.To; v++ {
+			if w.slots[v] != -1 {
+				return nil, fmt.Errorf("colour wheel: palette colour %d overlaps palette colour %d at %d", i+1, w.slots[v]+1, v)
+			}
+			w.slots[v] = i
+		}
+	}
+	if !ranged {
+		w.split()
+	}
+	return w, nil
+}
+
+// split divides the DMX values below the spin start evenly over the palette.
+func (w *Wheel) split() {
+	for v := 0; v < w.spinStart; v++ {
+		w.slots[v] = v * len(w.colors) / w.spinStart
+	}
+}
+
+// spinning returns true if the DMX value rotates the wheel.
+func (w *Wheel) spinning(value byte) bool {
+	return int(value) >= w.spinStart
+}
+
+// speed returns the spin speed in palette colours per second.
+func (w *Wheel) speed(value byte) float64 {
+	if w.spinStart >= 255 {
+		return maxSpinSpeed
+	}
+	return minSpinSpeed + float64(int(value)-w.spinStart)/float64(255-w.spinStart)*(maxSpinSpeed-minSpinSpeed)
+}
+
+// WheelState is the colour wheel of a single light, it keeps the wheel position while the wheel spins
+// so speed changes continue from the current colour.
+type WheelState struct {
+	wheel *Wheel
+	// position is the wheel position in palette colours.
+	position float64
+	last     time.Time
+}
+
+// NewState returns the state of a wheel for a single light.
+func (w *Wheel) NewState() *WheelState {
+	return &WheelState{wheel: w}
+}
+
+// Color returns the colour for a DMX value at the given time, spinning wheels blend between
+// neighbouring palette colours.
+func (s *WheelState) Color(value byte, now time.Time) (float64, float64, float64) {
+	w := s.wheel
+	if !w.spinning(value) {
+		// The spin starts from the current colour
+		s.last = time.Time{}
+		slot := w.slots[value]
+		if slot < 0 {
+			return 1, 1, 1
+		}
+		s.position = float64(slot)
+		c := w.colors[slot]
+		return c[0], c[1], c[2]
+	}
+	// Frames can carry a time before the last one, the wheel never spins back
+	if !s.last.IsZero() {
+		s.position += math.Max(0, now.Sub(s.last).Seconds()) * w.speed(value)
+	}
+	if now.After(s.last) {
+		s.last = now
+	}
+	n := float64(len(w.colors))
+	s.position = math.Mod(s.position, n)
+	if s.position < 0 {
+		s.position += n
+	}
+	i, frac := math.Modf(s.position)
+	a := w.colors[int(i)]
+	b := w.colors[(int(i)+1)%len(w.colors)]
+	return a[0]*(1-frac) + b[0]*frac, a[1]*(1-frac) + b[1]*frac, a[2]*(1-frac) + b[2]*frac
+}
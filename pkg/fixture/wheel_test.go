@@ -0,0 +1,50 @@
+package fixture
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWheelStateColor(t *testing.T) {
+	w, err := NewWheel(config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name string
+		// position is the wheel position before the first step.
+		position float64
+		steps    []time.Duration
+		value    byte
+		want     [3]float64
+	}{
+		{name: "static colour", value: 16, want: defaultPalette[1]},
+		{name: "value without spin", value: 0, want: defaultPalette[0]},
+		{name: "spin at full speed", value: 255, steps: []time.Duration{0, 200 * time.Millisecond}, want: defaultPalette[1]},
+		{name: "spin wraps around", position: 7, value: 255, steps: []time.Duration{0, 200 * time.Millisecond}, want: defaultPalette[0]},
+		{name: "time going back", position: 2, value: 255, steps: []time.Duration{0, -time.Second}, want: defaultPalette[2]},
+		{name: "negative position", position: -1, value: 255, steps: []time.Duration{0}, want: defaultPalette[7]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := w.NewState()
+			var r, g, b float64
+			if len(tt.steps) == 0 {
+				r, g, b = s.Color(tt.value, start)
+			}
+			s.position = tt.position
+			for _, step := range tt.steps {
+				r, g, b = s.Color(tt.value, start.Add(step))
+			}
+			got := [3]float64{r, g, b}
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package hue
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxChannels is the maximum number of channels in an entertainment configuration and a HueStream v2 packet.
+// The number of lights is taken from the channels of the entertainment configuration the bridge returns,
+// this limit only bounds the number of lights when the bridge is not queried, e.g. with the dryrun output.
+const MaxChannels = 20
+
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// ChannelMember is a light (or light segment) that is part of an entertainment channel.
+type ChannelMember struct {
+	DeviceID string
+	Name     string
+	ModelID  string
+	// Gamut is the colour gamut of the light, nil for lights that don't report one.
+	Gamut *Gamut
+	// Index is the segment of the device, 0 for lights with a single segment.
+	Index int
+}
+
+// EntertainmentChannel is a channel of an entertainment configuration as streamed to in HueStream packets.
+type EntertainmentChannel struct {
+	ID       uint8
+	Position Position
+	Members  []ChannelMember
+}
+
+type resourceReference struct {
+	RID   string `json:"rid"`
+	RType string `json:"rtype"`
+}
+
+type entertainmentConfigurationResponse struct {
+	Errors []interface{} `json:"errors"`
+	Data   []struct {
+		ID       string `json:"id"`
+		Channels []struct {
+			ChannelID uint8    `json:"channel_id"`
+			Position  Position `json:"position"`
+			Members   []struct {
+				Service resourceReference `json:"service"`
+				Index   int               `json:"index"`
+			} `json:"members"`
+		} `json:"channels"`
+	} `json:"data"`
+}
+
+type entertainmentResponse struct {
+	Data []struct {
+		ID    string            `json:"id"`
+		Owner resourceReference `json:"owner"`
+	} `json:"data"`
+}
+
+type deviceResponse struct {
+	Data []struct {
+		ID       string `json:"id"`
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		ProductData struct {
+			ModelID string `json:"model_id"`
+		} `json:"product_data"`
+	} `json:"data"`
+}
+
+type lightResponse struct {
+	Data []struct {
+		Owner resourceReference `json:"owner"`
+		Color *struct {
+			Gamut     *Gamut `json:"gamut"`
+			GamutType string `json:"gamut_type"`
+		} `json:"color"`
+	} `json:"data"`
+}
+
+// getResource fetches a CLIP v2 resource and decodes the JSON response into v.
+func getResource(config config.Config, resource string, v interface{}) error {
+	url := fmt.Sprintf("https://%s/clip/v2/resource/%s", config.HueBridgeIP, resource)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("hue-application-key", config.Username)
+	client := &http.Client{Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			log.Printf("Failed to close response body: %v", err)
+		}
+	}(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get %s: %s", resource, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// GetEntertainmentChannels returns the channels of the entertainment zone in config, ordered by channel ID,
+// with the name, model and gamut of the devices that make up each channel.
+func GetEntertainmentChannels(config config.Config) ([]EntertainmentChannel, error) {
+	var configResponse entertainmentConfigurationResponse
+	err := getResource(config, "entertainment_configuration/"+config.EntertainmentZone, &configResponse)
+	if err != nil {
+		return nil, err
+	}
+	if len(configResponse.Data) == 0 {
+		return nil, fmt.Errorf("entertainment configuration %s not found", config.EntertainmentZone)
+	}
+
+	var entertainment entertainmentResponse
+	if err := getResource(config, "entertainment", &entertainment); err != nil {
+		return nil, err
+	}
+	owners := make(map[string]string)
+	for _, service := range entertainment.Data {
+		owners[service.ID] = service.Owner.RID
+	}
+
+	var devices deviceResponse
+	if err := getResource(config, "device", &devices); err != nil {
+		return nil, err
+	}
+	deviceNames := make(map[string]string)
+	deviceModels := make(map[string]string)
+	for _, device := range devices.Data {
+		deviceNames[device.ID] = device.Metadata.Name
+		deviceModels[device.ID] = device.ProductData.ModelID
+	}
+
+	var lights lightResponse
+	if err := getResource(config, "light", &lights); err != nil {
+		return nil, err
+	}
+	deviceGamuts := make(map[string]*Gamut)
+	for _, light := range lights.Data {
+		if light.Color == nil {
+			continue
+		}
+		gamut := light.Color.Gamut
+		if gamut == nil {
+			if known, err := GamutByType(light.Color.GamutType); err == nil {
+				gamut = &known
+			}
+		}
+		deviceGamuts[light.Owner.RID] = gamut
+	}
+
+	var channels []EntertainmentChannel
+	for _, ch := range configResponse.Data[0].Channels {
+		channel := EntertainmentChannel{ID: ch.ChannelID, Position: ch.Position}
+		for _, member := range ch.Members {
+			deviceID := owners[member.Service.RID]
+			channel.Members = append(channel.Members, ChannelMember{
+				DeviceID: deviceID,
+				Name:     deviceNames[deviceID],
+				ModelID:  deviceModels[deviceID],
+				Gamut:    deviceGamuts[deviceID],
+				Index:    member.Index,
+			})
+		}
+		channels = append(channels, channel)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].ID < channels[j].ID })
+	return channels, nil
+}
+
+// Gamut returns the gamut of the first member of the channel that reports one.
+func (c EntertainmentChannel) Gamut() *Gamut {
+	for _, member := range c.Members {
+		if member.Gamut != nil {
+			return member.Gamut
+		}
+	}
+	return nil
+}
+
+// LightByName returns the 0-based light index of the channel with a member of the given name, ignoring case.
+// Devices with a channel per segment, like gradient lightstrips and Festavia, are part of several channels
+// and cannot be selected by name.
+func LightByName(channels []EntertainmentChannel, name string) (int, error) {
+	var matches []int
+	for light, channel := range channels {
+		if slices.ContainsFunc(channel.Members, func(member ChannelMember) bool {
+			return strings.EqualFold(member.Name, name)
+		}) {
+			matches = append(matches, light)
+		}
+	}
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("no light named %q in the entertainment configuration", name)
+	}
+	if len(matches) > 1 {
+		return 0, fmt.Errorf("%q is part of %d channels of the entertainment configuration, select a single channel instead", name, len(matches))
+	}
+	return matches[0], nil
+}
+
+// Device is a physical device and the lights (channels) it is made of, gradient lightstrips and
+// Festavia have a channel per segment.
+type Device struct {
+	ID      string
+	Name    string
+	ModelID string
+	// Lights are the 0-based light indices of the segments in segment order.
+	Lights []int
+}
+
+// Devices groups the channels by device, in order of their first channel.
+func Devices(channels []EntertainmentChannel) []Device {
+	var devices []Device
+	byID := make(map[string]int)
+	segments := make(map[string][]int)
+	for light, channel := range channels {
+		for _, member := range channel.Members {
+			i, ok := byID[member.DeviceID]
+			if !ok {
+				i = len(devices)
+				byID[member.DeviceID] = i
+				devices = append(devices, Device{ID: member.DeviceID, Name: member.Name, ModelID: member.ModelID})
+			}
+			if !slices.Contains(devices[i].Lights, light) {
+				devices[i].Lights = append(devices[i].Lights, light)
+				segments[member.DeviceID] = append(segments[member.DeviceID], member.Index)
+			}
+		}
+	}
+	for i := range devices {
+		lights, index := devices[i].Lights, segments[devices[i].ID]
+		sort.Sort(bySegment{lights, index})
+	}
+	return devices
+}
+
+// bySegment sorts the lights of a device by their segment index.
+type bySegment struct {
+	lights []int
+	index  []int
+}
+
+func (s bySegment) Len() int           { return len(s.lights) }
+func (s bySegment) Less(i, j int) bool { return s.index[i] < s.index[j] }
+func (s bySegment) Swap(i, j int) {
+	s.lights[i], s.lights[j] = s.lights[j], s.lights[i]
+	s.index[i], s.index[j] = s.index[j], s.index[i]
+}
+
+// ChannelIDs returns the IDs of the channels in order.
+func ChannelIDs(channels []EntertainmentChannel) []uint8 {
+	ids := make([]uint8, len(channels))
+	for i, channel := range channels {
+		ids[i] = channel.ID
+	}
+	return ids
+}
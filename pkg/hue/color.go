@@ -0,0 +1,237 @@
+package hue
+
+import (
+	"fmt"
+	"math"
+)
+
+type XY struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Gamut is the triangle of colours a light can reproduce.
+type Gamut struct {
+	Red   XY `json:"red"`
+	Green XY `json:"green"`
+	Blue  XY `json:"blue"`
+}
+
+var (
+	GamutA = Gamut{Red: XY{0.704, 0.296}, Green: XY{0.2151, 0.7106}, Blue: XY{0.138, 0.08}}
+	GamutB = Gamut{Red: XY{0.675, 0.322}, Green: XY{0.409, 0.518}, Blue: XY{0.167, 0.04}}
+	GamutC = Gamut{Red: XY{0.6915, 0.3083}, Green: XY{0.17, 0.7}, Blue: XY{0.1532, 0.0475}}
+)
+
+// WhitePoint is the D65 white point.
+var WhitePoint = XY{0.3127, 0.3290}
+
+const (
+	// GamutClip moves out of gamut colours to the closest colour on the gamut edge.
+	GamutClip = "clip"
+	// GamutCompress moves out of gamut colours towards the white point until they are in gamut, keeping their hue.
+	GamutCompress = "compress"
+)
+
+// GamutByType returns the gamut for a Hue gamut type (A, B or C).
+func GamutByType(gamutType string) (Gamut, error) {
+	switch gamutType {
+	case "A":
+		return GamutA, nil
+	case "B":
+		return GamutB, nil
+	case "C":
+		return GamutC, nil
+	}
+	return Gamut{}, fmt.Errorf("unknown gamut type %q", gamutType)
+}
+
+// RGBToXY converts a 16-bit sRGB colour to CIE xy and a brightness between 0 and 1.
+// The brightness is the brightest colour component, so saturated colours keep their DMX intensity.
+func RGBToXY(state EntertainmentLightState) (XY, float64) {
+	r := float64(state.Red) / 65535
+	g := float64(state.Green) / 65535
+	b := float64(state.Blue) / 65535
+	brightness := math.Max(r, math.Max(g, b))
+	if brightness == 0 {
+		return WhitePoint, 0
+	}
+	r, g, b = Linearize(r), Linearize(g), Linearize(b)
+	// Wide gamut conversion matrix (D65) as used by Philips Hue
+	x := r*0.664511 + g*0.154324 + b*0.162028
+	y := r*0.283881 + g*0.668433 + b*0.047685
+	z := r*0.000088 + g*0.072310 + b*0.986039
+	sum := x + y + z
+	if sum == 0 {
+		return WhitePoint, 0
+	}
+	return XY{x / sum, y / sum}, brightness
+}
+
+// ToUint16 converts a colour component (0.0-1.0) to 16 bits, values out of range are clamped.
+func ToUint16(v float64) uint16 {
+	return uint16(math.Round(math.Max(0, math.Min(1, v)) * 65535))
+}
+
+// HSVToRGB converts hue, saturation and value (all 0.0-1.0) into red, green and blue.
+func HSVToRGB(h, s, v float64) (float64, float64, float64) {
+	h = math.Mod(h*6, 6)
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	m := v - c
+	var r, g, b float64
+	switch {
+	case h < 1:
+		r, g, b = c, x, 0
+	case h < 2:
+		r, g, b = x, c, 0
+	case h < 3:
+		r, g, b = 0, c, x
+	case h < 4:
+		r, g, b = 0, x, c
+	case h < 5:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return r + m, g + m, b + m
+}
+
+// XYToRGB converts CIE xy to linear RGB, scaled so the brightest component is 1.
+func XYToRGB(xy XY) (float64, float64, float64) {
+	if xy.Y == 0 {
+		return 0, 0, 0
+	}
+	x := xy.X / xy.Y
+	z := (1 - xy.X - xy.Y) / xy.Y
+	// Inverse of the wide gamut conversion matrix used by RGBToXY, with Y = 1
+	r := x*1.656492 - 1*0.354851 - z*0.255038
+	g := -x*0.707196 + 1*1.655397 + z*0.036152
+	b := x*0.051713 - 1*0.121364 + z*1.011530
+	r, g, b = math.Max(0, r), math.Max(0, g), math.Max(0, b)
+	brightest := math.Max(r, math.Max(g, b))
+	if brightest == 0 {
+		return 0, 0, 0
+	}
+	return r / brightest, g / brightest, b / brightest
+}
+
+// PlanckianXY returns the CIE xy colour of a black body at the given temperature (1667K-25000K),
+// using the cubic spline approximation of Kim et al.
+func PlanckianXY(kelvin float64) XY {
+	t := math.Max(1667, math.Min(25000, kelvin))
+	var x float64
+	if t <= 4000 {
+		x = -0.2661239e9/(t*t*t) - 0.2343589e6/(t*t) + 0.8776956e3/t + 0.179910
+	} else {
+		x = -3.0258469e9/(t*t*t) + 2.1070379e6/(t*t) + 0.2226347e3/t + 0.240390
+	}
+	var y float64
+	switch {
+	case t <= 2222:
+		y = -1.1063814*x*x*x - 1.34811020*x*x + 2.18555832*x - 0.20219683
+	case t <= 4000:
+		y = -0.9549476*x*x*x - 1.37418593*x*x + 2.09137015*x - 0.16748867
+	default:
+		y = 3.0817580*x*x*x - 5.87338670*x*x + 3.75112997*x - 0.37001483
+	}
+	return XY{x, y}
+}
+
+// Linearize converts a gamma encoded sRGB component (0.0-1.0) to linear light.
+func Linearize(v float64) float64 {
+	if v > 0.04045 {
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return v / 12.92
+}
+
+// Delinearize converts a linear light component (0.0-1.0) to gamma encoded sRGB.
+func Delinearize(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// Contains returns true if xy is inside the gamut triangle.
+func (g Gamut) Contains(xy XY) bool {
+	d1 := cross(g.Red, g.Green, xy)
+	d2 := cross(g.Green, g.Blue, xy)
+	d3 := cross(g.Blue, g.Red, xy)
+	hasNegative := d1 < 0 || d2 < 0 || d3 < 0
+	hasPositive := d1 > 0 || d2 > 0 || d3 > 0
+	return !(hasNegative && hasPositive)
+}
+
+// Map returns xy if it is inside the gamut, otherwise the reachable colour chosen by mapping.
+func (g Gamut) Map(xy XY, mapping string) XY {
+	if g.Contains(xy) {
+		return xy
+	}
+	if mapping == GamutCompress {
+		return g.compress(xy)
+	}
+	return g.closest(xy)
+}
+
+func (g Gamut) closest(xy XY) XY {
+	candidates := []XY{
+		closestOnSegment(g.Red, g.Green, xy),
+		closestOnSegment(g.Green, g.Blue, xy),
+		closestOnSegment(g.Blue, g.Red, xy),
+	}
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if distance(c, xy) < distance(best, xy) {
+			best = c
+		}
+	}
+	return best
+}
+
+// compress returns the point where the line from the white point to xy crosses the gamut edge.
+func (g Gamut) compress(xy XY) XY {
+	white := WhitePoint
+	if !g.Contains(white) {
+		white = XY{(g.Red.X + g.Green.X + g.Blue.X) / 3, (g.Red.Y + g.Green.Y + g.Blue.Y) / 3}
+	}
+	edges := [][2]XY{{g.Red, g.Green}, {g.Green, g.Blue}, {g.Blue, g.Red}}
+	for _, edge := range edges {
+		if p, ok := intersect(white, xy, edge[0], edge[1]); ok {
+			return p
+		}
+	}
+	return g.closest(xy)
+}
+
+func cross(a, b, p XY) float64 {
+	return (b.X-a.X)*(p.Y-a.Y) - (b.Y-a.Y)*(p.X-a.X)
+}
+
+func distance(a, b XY) float64 {
+	return math.Hypot(a.X-b.X, a.Y-b.Y)
+}
+
+func closestOnSegment(a, b, p XY) XY {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	t := ((p.X-a.X)*dx + (p.Y-a.Y)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return XY{a.X + t*dx, a.Y + t*dy}
+}
+
+// intersect returns the intersection of segment p1-p2 with segment q1-q2.
+func intersect(p1, p2, q1, q2 XY) (XY, bool) {
+	rx, ry := p2.X-p1.X, p2.Y-p1.Y
+	sx, sy := q2.X-q1.X, q2.Y-q1.Y
+	denominator := rx*sy - ry*sx
+	if denominator == 0 {
+		return XY{}, false
+	}
+	t := ((q1.X-p1.X)*sy - (q1.Y-p1.Y)*sx) / denominator
+	u := ((q1.X-p1.X)*ry - (q1.Y-p1.Y)*rx) / denominator
+	if t < 0 || t > 1 || u < 0 || u > 1 {
+		return XY{}, false
+	}
+	return XY{p1.X + t*rx, p1.Y + t*ry}, true
+}
@@ -3,6 +3,7 @@ package hue
 import (
 	"bytes"
 	"crypto/tls"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"github.com/pion/dtls/v2"
@@ -21,14 +22,40 @@ type EntertainmentConfigResponse struct {
 	} `json:"data"`
 }
 
+// EntertainmentLightState is the colour of a single light with 16-bit resolution per colour.
 type EntertainmentLightState struct {
-	Red   int `json:"red"`
-	Green int `json:"green"`
-	Blue  int `json:"blue"`
+	Red   uint16 `json:"red"`
+	Green uint16 `json:"green"`
+	Blue  uint16 `json:"blue"`
+	// Strobe is the DMX strobe value of fixtures with a strobe channel, 0 means no strobe.
+	Strobe int `json:"strobe,omitempty"`
 }
 
 type Streamer struct {
-	conn *dtls.Conn
+	conn       *dtls.Conn
+	config     config.Config
+	channelIDs []uint8
+	gamuts     []*Gamut
+}
+
+// LightUpdateRate is roughly how many times per second the bridge updates the lights of an entertainment zone.
+const LightUpdateRate = 25
+
+const (
+	ColorModeRGB = "rgb"
+	ColorModeXY  = "xy"
+
+	colorSpaceRGB = 0x00
+	colorSpaceXY  = 0x01
+)
+
+// RGB8 returns the light state for an 8-bit colour, scaling each colour to 16 bits.
+func RGB8(red, green, blue byte) EntertainmentLightState {
+	return EntertainmentLightState{
+		Red:   uint16(red) * 257,
+		Green: uint16(green) * 257,
+		Blue:  uint16(blue) * 257,
+	}
 }
 
 func StartEntertainmentArea(config config.Config) error {
@@ -55,16 +82,45 @@ func StartEntertainmentArea(config config.Config) error {
 	return nil
 }
 
-func BuildHueStreamPacket(configID string, states []EntertainmentLightState) []byte {
+// BuildHueStreamPacket builds a HueStream v2 packet, state i is sent to channelIDs[i].
+// Without channel IDs, or for states beyond them, the index of the state is used as channel ID.
+func BuildHueStreamPacket(configID string, channelIDs []uint8, states []EntertainmentLightState) []byte {
+	values := make([][3]uint16, len(states))
+	for i, state := range states {
+		values[i] = [3]uint16{state.Red, state.Green, state.Blue}
+	}
+	return buildPacket(configID, colorSpaceRGB, channelIDs, values)
+}
+
+// BuildHueStreamXYPacket builds a HueStream v2 packet in the XY + brightness colour space.
+// Colours outside the gamut of a light are mapped into it, lights without a gamut get the colour as is.
+func BuildHueStreamXYPacket(configID string, channelIDs []uint8, states []EntertainmentLightState, gamuts []*Gamut, gamutMapping string) []byte {
+	values := make([][3]uint16, len(states))
+	for i, state := range states {
+		xy, brightness := RGBToXY(state)
+		if i < len(gamuts) && gamuts[i] != nil {
+			xy = gamuts[i].Map(xy, gamutMapping)
+		}
+		values[i] = [3]uint16{ToUint16(xy.X), ToUint16(xy.Y), ToUint16(brightness)}
+	}
+	return buildPacket(configID, colorSpaceXY, channelIDs, values)
+}
+
+func buildPacket(configID string, colorSpace byte, channelIDs []uint8, values [][3]uint16) []byte {
 	protocolName := []byte("HueStream")
-	header := []byte{0x02, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}
+	header := []byte{0x02, 0x00, 0x01, 0x00, 0x00, colorSpace, 0x00}
 	configIDBuf := make([]byte, 36)
 	copy(configIDBuf, configID)
-	var channels []byte
-	for i, state := range states {
-		ch := []byte{byte(i)}
-		ch = append(ch, byte(state.Red), byte(state.Red), byte(state.Green), byte(state.Green), byte(state.Blue), byte(state.Blue))
-		channels = append(channels, ch...)
+	channels := make([]byte, 0, len(values)*7)
+	for i, value := range values {
+		channelID := uint8(i)
+		if i < len(channelIDs) {
+			channelID = channelIDs[i]
+		}
+		channels = append(channels, channelID)
+		for _, v := range value {
+			channels = binary.BigEndian.AppendUint16(channels, v)
+		}
 	}
 	return bytes.Join([][]byte{protocolName, header, configIDBuf, channels}, nil)
 }
@@ -91,6 +147,7 @@ func (hs *Streamer) Connect(config config.Config, hueAppId string) error {
 		return fmt.Errorf("DTLS dial failed: %w", err)
 	}
 	hs.conn = conn
+	hs.config = config
 	return nil
 }
 
@@ -98,7 +155,39 @@ func (hs *Streamer) StreamToHue(config config.Config, states []EntertainmentLigh
 	if hs.conn == nil {
 		return fmt.Errorf("DTLS connection not established")
 	}
-	packet := BuildHueStreamPacket(config.EntertainmentZone, states)
+	var packet []byte
+	if config.ColorMode == ColorModeXY {
+		packet = BuildHueStreamXYPacket(config.EntertainmentZone, hs.channelIDs, states, hs.gamuts, config.GamutMapping)
+	} else {
+		packet = BuildHueStreamPacket(config.EntertainmentZone, hs.channelIDs, states)
+	}
 	_, err := hs.conn.Write(packet)
 	return err
 }
+
+// SetChannels sets the entertainment channel every light is streamed to, in light order.
+func (hs *Streamer) SetChannels(channels []EntertainmentChannel) {
+	hs.channelIDs = ChannelIDs(channels)
+	hs.gamuts = make([]*Gamut, len(channels))
+	for i, channel := range channels {
+		hs.gamuts[i] = channel.Gamut()
+	}
+}
+
+func (hs *Streamer) Name() string {
+	return "hue"
+}
+
+// Write streams the states to the entertainment zone the streamer is connected to.
+func (hs *Streamer) Write(states []EntertainmentLightState) error {
+	return hs.StreamToHue(hs.config, states)
+}
+
+func (hs *Streamer) Close() error {
+	if hs.conn == nil {
+		return nil
+	}
+	err := hs.conn.Close()
+	hs.conn = nil
+	return err
+}
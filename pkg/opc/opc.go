@@ -0,0 +1,160 @@
+package opc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"github.com/techwolf12/artnet-to-hue/pkg/source"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+)
+
+const (
+	DefaultPort = 7890
+
+	headerLength = 4
+
+	broadcastChannel = 0
+
+	commandSetPixelColours = 0x00
+	commandSystemExclusive = 0xff
+)
+
+func init() {
+	source.Register("opc", func(config config.Config) (source.Source, error) {
+		return NewServer(config)
+	})
+}
+
+// Message is a single Open Pixel Control message.
+type Message struct {
+	Channel byte
+	Command byte
+	Data    []byte
+}
+
+// ReadMessage reads the next message from an OPC stream.
+func ReadMessage(r io.Reader) (Message, error) {
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Message{}, err
+	}
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return Message{}, err
+	}
+	return Message{Channel: header[0], Command: header[1], Data: data}, nil
+}
+
+// Server accepts Open Pixel Control clients over TCP and maps pixel n onto entertainment light n.
+type Server struct {
+	*source.Feed
+	listener net.Listener
+	channel  byte
+	pixels   []byte
+	mu       sync.Mutex
+	config   config.Config
+}
+
+func NewServer(config config.Config) (*Server, error) {
+	if config.OPCPort < 1 || config.OPCPort > 65535 {
+		return nil, errors.New("OPC port must be between 1 and 65535")
+	}
+	if config.OPCChannel < 0 || config.OPCChannel > 255 {
+		return nil, errors.New("OPC channel must be between 0 and 255")
+	}
+	return &Server{
+		Feed:    source.NewFeed("opc"),
+		channel: byte(config.OPCChannel),
+		pixels:  make([]byte, config.NumLights*3),
+		config:  config,
+	}, nil
+}
+
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", "0.0.0.0:"+strconv.Itoa(s.config.OPCPort))
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go s.accept()
+	return nil
+}
+
+// Stop stops accepting new clients, connected clients are served until they disconnect but their frames are discarded.
+func (s *Server) Stop() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) accept() {
+	defer s.Close()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Error accepting OPC connection: %v", err)
+			}
+			return
+		}
+		if s.config.Debug {
+			log.Printf("OPC client connected from %s", conn.RemoteAddr())
+		}
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer func(conn net.Conn) {
+		err := conn.Close()
+		if err != nil {
+			log.Printf("Failed to close OPC connection: %v", err)
+		}
+	}(conn)
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := ReadMessage(r)
+		if err != nil {
+			if s.config.Debug && !errors.Is(err, io.EOF) {
+				log.Printf("OPC client %s disconnected: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		s.Packet()
+		if msg.Channel != broadcastChannel && msg.Channel != s.channel {
+			continue
+		}
+		switch msg.Command {
+		case commandSetPixelColours:
+			s.setPixelColours(msg.Data)
+		case commandSystemExclusive:
+			// Firmware configuration (e.g. Fadecandy dithering and colour correction) has no meaning for Hue lights
+			if s.config.Debug {
+				log.Printf("Ignoring OPC system exclusive message of %d bytes", len(msg.Data))
+			}
+		default:
+			if s.config.Debug {
+				log.Printf("Ignoring unsupported OPC command 0x%02x", msg.Command)
+			}
+		}
+	}
+}
+
+func (s *Server) setPixelColours(data []byte) {
+	s.mu.Lock()
+	copy(s.pixels, data)
+	states := make([]hue.EntertainmentLightState, len(s.pixels)/3)
+	for i := range states {
+		states[i] = hue.RGB8(s.pixels[i*3], s.pixels[i*3+1], s.pixels[i*3+2])
+	}
+	s.mu.Unlock()
+	s.Send(source.Frame{Lights: states})
+}
@@ -0,0 +1,200 @@
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const bundleTag = "#bundle\x00"
+
+// ntpEpochOffset is the number of seconds between 1900-01-01 (NTP epoch) and 1970-01-01 (Unix epoch).
+const ntpEpochOffset = 2208988800
+
+type Message struct {
+	Address   string
+	Arguments []interface{}
+	// Time at which the message should be applied, zero means immediately.
+	Time time.Time
+}
+
+func readString(b []byte) (string, []byte, error) {
+	end := bytes.IndexByte(b, 0)
+	if end < 0 {
+		return "", nil, errors.New("unterminated OSC string")
+	}
+	s := string(b[:end])
+	padded := (end + 4) &^ 3
+	if padded > len(b) {
+		return "", nil, errors.New("OSC string padding exceeds packet")
+	}
+	return s, b[padded:], nil
+}
+
+func timetagToTime(tag uint64) time.Time {
+	// A timetag of 1 means "immediately"
+	if tag <= 1 {
+		return time.Time{}
+	}
+	secs := int64(tag>>32) - ntpEpochOffset
+	frac := tag & 0xffffffff
+	nanos := int64((frac * uint64(time.Second)) >> 32)
+	return time.Unix(secs, nanos)
+}
+
+// Parse decodes an OSC packet into its messages, flattening bundles.
+// Messages inside a bundle inherit the timetag of the innermost bundle.
+func Parse(b []byte) ([]Message, error) {
+	return parsePacket(b, time.Time{})
+}
+
+func parsePacket(b []byte, at time.Time) ([]Message, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty OSC packet")
+	}
+	if bytes.HasPrefix(b, []byte(bundleTag)) {
+		return parseBundle(b)
+	}
+	msg, err := parseMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	msg.Time = at
+	return []Message{msg}, nil
+}
+
+func parseBundle(b []byte) ([]Message, error) {
+	if len(b) < 16 {
+		return nil, errors.New("OSC bundle too short")
+	}
+	at := timetagToTime(binary.BigEndian.Uint64(b[8:16]))
+	b = b[16:]
+	var messages []Message
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, errors.New("truncated OSC bundle element size")
+		}
+		size := int(binary.BigEndian.Uint32(b[:4]))
+		b = b[4:]
+		if size > len(b) {
+			return nil, errors.New("OSC bundle element exceeds packet")
+		}
+		elementMessages, err := parsePacket(b[:size], at)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, elementMessages...)
+		b = b[size:]
+	}
+	return messages, nil
+}
+
+func parseMessage(b []byte) (Message, error) {
+	address, rest, err := readString(b)
+	if err != nil {
+		return Message{}, err
+	}
+	if len(address) == 0 || address[0] != '/' {
+		return Message{}, fmt.Errorf("invalid OSC address %q", address)
+	}
+	msg := Message{Address: address}
+	// Type tag string is optional in very old implementations
+	if len(rest) == 0 {
+		return msg, nil
+	}
+	tags, rest, err := readString(rest)
+	if err != nil {
+		return Message{}, err
+	}
+	if len(tags) == 0 || tags[0] != ',' {
+		return Message{}, fmt.Errorf("invalid OSC type tag %q", tags)
+	}
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'i':
+			if len(rest) < 4 {
+				return Message{}, errors.New("truncated int32 argument")
+			}
+			msg.Arguments = append(msg.Arguments, int32(binary.BigEndian.Uint32(rest[:4])))
+			rest = rest[4:]
+		case 'f':
+			if len(rest) < 4 {
+				return Message{}, errors.New("truncated float32 argument")
+			}
+			msg.Arguments = append(msg.Arguments, math.Float32frombits(binary.BigEndian.Uint32(rest[:4])))
+			rest = rest[4:]
+		case 'h':
+			if len(rest) < 8 {
+				return Message{}, errors.New("truncated int64 argument")
+			}
+			msg.Arguments = append(msg.Arguments, int64(binary.BigEndian.Uint64(rest[:8])))
+			rest = rest[8:]
+		case 'd':
+			if len(rest) < 8 {
+				return Message{}, errors.New("truncated float64 argument")
+			}
+			msg.Arguments = append(msg.Arguments, math.Float64frombits(binary.BigEndian.Uint64(rest[:8])))
+			rest = rest[8:]
+		case 't':
+			if len(rest) < 8 {
+				return Message{}, errors.New("truncated timetag argument")
+			}
+			msg.Arguments = append(msg.Arguments, timetagToTime(binary.BigEndian.Uint64(rest[:8])))
+			rest = rest[8:]
+		case 's', 'S':
+			var s string
+			s, rest, err = readString(rest)
+			if err != nil {
+				return Message{}, err
+			}
+			msg.Arguments = append(msg.Arguments, s)
+		case 'b':
+			if len(rest) < 4 {
+				return Message{}, errors.New("truncated blob size")
+			}
+			size := int(binary.BigEndian.Uint32(rest[:4]))
+			padded := (size + 3) &^ 3
+			if 4+padded > len(rest) {
+				return Message{}, errors.New("OSC blob exceeds packet")
+			}
+			msg.Arguments = append(msg.Arguments, rest[4:4+size])
+			rest = rest[4+padded:]
+		case 'T':
+			msg.Arguments = append(msg.Arguments, true)
+		case 'F':
+			msg.Arguments = append(msg.Arguments, false)
+		case 'N', 'I':
+			msg.Arguments = append(msg.Arguments, nil)
+		default:
+			return Message{}, fmt.Errorf("unsupported OSC type tag %q", tag)
+		}
+	}
+	return msg, nil
+}
+
+// Float returns argument i as a float64, converting numeric and boolean types.
+// NaN and infinite values are rejected, they cannot be clamped to a range.
+func (m Message) Float(i int) (float64, bool) {
+	if i >= len(m.Arguments) {
+		return 0, false
+	}
+	switch v := m.Arguments[i].(type) {
+	case float32:
+		return float64(v), !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0)
+	case float64:
+		return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
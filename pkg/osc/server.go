@@ -0,0 +1,358 @@
+package osc
+
+import (
+	"errors"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/effect"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"github.com/techwolf12/artnet-to-hue/pkg/source"
+	"log"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPort = 8000
+	// maxSchedule is how far in the future a bundle can be scheduled, bundles with a later timetag are rejected.
+	maxSchedule = 5 * time.Second
+)
+
+func init() {
+	source.Register("osc", func(config config.Config) (source.Source, error) {
+		return NewServer(config)
+	})
+}
+
+// Server receives OSC messages over UDP and turns them into light states.
+//
+// Supported address patterns:
+//
+//	/hue/<zone>/light/<n>/rgb f f f   set light n (1-based) to red, green, blue (0.0-1.0)
+//	/hue/<zone>/master f              scale all lights (0.0-1.0)
+//	/hue/<zone>/blackout i            non-zero forces all lights off
+//	/hue/scene/<name>                 recall a stored scene
+//	/hue/scene/<name>/store           store the current light states as a scene
+//	/hue/<zone>/effect s              select a built-in effect by name, "off" stops it
+//	/hue/<zone>/effect/<param> f      set the speed, size, intensity or direction of the effect (0.0-1.0)
+//	/hue/<zone>/effect/color f f f    set the colour of the effect
+//	/hue/<zone>/effect/origin f f     set the x and y position pulses and sweeps start from (-1.0-1.0)
+//
+// <zone> is the entertainment zone ID or "*".
+type Server struct {
+	*source.Feed
+	conn     *net.UDPConn
+	zone     string
+	states   []hue.EntertainmentLightState
+	master   float64
+	blackout bool
+	scenes   map[string][]hue.EntertainmentLightState
+	// effect holds the effect changes of the messages being applied.
+	effect effect.Settings
+	mu     sync.Mutex
+	config config.Config
+}
+
+func NewServer(config config.Config) (*Server, error) {
+	if config.OSCPort < 1 || config.OSCPort > 65535 {
+		return nil, errors.New("OSC port must be between 1 and 65535")
+	}
+	return &Server{
+		Feed:   source.NewFeed("osc"),
+		zone:   config.EntertainmentZone,
+		states: make([]hue.EntertainmentLightState, config.NumLights),
+		master: 1,
+		scenes: make(map[string][]hue.EntertainmentLightState),
+		config: config,
+	}, nil
+}
+
+func (s *Server) Start() error {
+	addr, err := net.ResolveUDPAddr("udp", "0.0.0.0:"+strconv.Itoa(s.config.OSCPort))
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	go s.listen()
+	return nil
+}
+
+func (s *Server) Stop() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *Server) listen() {
+	defer s.Close()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		s.Packet()
+		messages, err := Parse(buf[:n])
+		if err != nil {
+			s.Invalid()
+			if s.config.Debug {
+				log.Printf("Invalid OSC packet from %s: %v", addr, err)
+			}
+			continue
+		}
+		// Messages of a bundle share its timetag, every bundle is applied as a single update
+		var immediate []Message
+		var scheduled [][]Message
+		for _, msg := range messages {
+			if msg.Time.IsZero() || !msg.Time.After(time.Now()) {
+				immediate = append(immediate, msg)
+				continue
+			}
+			i := slices.IndexFunc(scheduled, func(bundle []Message) bool { return bundle[0].Time.Equal(msg.Time) })
+			if i < 0 {
+				scheduled = append(scheduled, nil)
+				i = len(scheduled) - 1
+			}
+			scheduled[i] = append(scheduled[i], msg)
+		}
+		for _, bundle := range scheduled {
+			if delay := time.Until(bundle[0].Time); delay > maxSchedule {
+				s.Invalid()
+				if s.config.Debug {
+					log.Printf("Rejecting OSC bundle from %s scheduled %s ahead, at most %s is supported", addr, delay, maxSchedule)
+				}
+				continue
+			}
+			s.schedule(bundle)
+		}
+		if len(immediate) > 0 {
+			s.apply(immediate)
+		}
+	}
+}
+
+// schedule applies the messages of a bundle at their timetag.
+func (s *Server) schedule(bundle []Message) {
+	delay := time.Until(bundle[0].Time)
+	if s.config.Debug {
+		log.Printf("Scheduling OSC bundle of %d messages in %s", len(bundle), delay)
+	}
+	time.AfterFunc(delay, func() {
+		s.apply(bundle)
+	})
+}
+
+// change is what a message changed.
+type change int
+
+const (
+	noChange change = iota
+	lightsChanged
+	effectChanged
+)
+
+// apply handles a group of messages and emits a single update for all of them.
+func (s *Server) apply(messages []Message) {
+	s.mu.Lock()
+	var lights, effects bool
+	for _, msg := range messages {
+		switch s.handle(msg) {
+		case lightsChanged:
+			lights = true
+		case effectChanged:
+			effects = true
+		default:
+			if s.config.Debug {
+				log.Printf("Ignoring OSC message %s %v", msg.Address, msg.Arguments)
+			}
+		}
+	}
+	var frames []source.Frame
+	if effects {
+		// Only the changed parameters are sent, the others keep the values from the config or DMX
+		settings := s.effect
+		s.effect = effect.Settings{}
+		frames = append(frames, source.Frame{Effect: &settings})
+	}
+	if lights {
+		frames = append(frames, source.Frame{Lights: s.output()})
+	}
+	s.mu.Unlock()
+	for _, frame := range frames {
+		s.Send(frame)
+	}
+}
+
+// handle applies a single message to the state, it must be called with the lock held.
+func (s *Server) handle(msg Message) change {
+	parts := strings.Split(strings.TrimPrefix(msg.Address, "/"), "/")
+	if len(parts) < 3 || parts[0] != "hue" {
+		return noChange
+	}
+	if parts[1] == "scene" {
+		name := parts[2]
+		if len(parts) == 4 && parts[3] == "store" {
+			s.scenes[name] = append([]hue.EntertainmentLightState(nil), s.states...)
+			return lightsChanged
+		}
+		scene, ok := s.scenes[name]
+		if len(parts) != 3 || !ok {
+			return noChange
+		}
+		copy(s.states, scene)
+		return lightsChanged
+	}
+	if parts[1] != s.zone && parts[1] != "*" {
+		return noChange
+	}
+	switch {
+	case parts[2] == "effect":
+		if s.handleEffect(parts[3:], msg) {
+			return effectChanged
+		}
+		return noChange
+	case len(parts) == 3 && parts[2] == "master":
+		level, ok := msg.Float(0)
+		if !ok {
+			return noChange
+		}
+		s.master = clamp(level)
+		return lightsChanged
+	case len(parts) == 3 && parts[2] == "blackout":
+		value, ok := msg.Float(0)
+		if !ok {
+			return noChange
+		}
+		s.blackout = value != 0
+		return lightsChanged
+	case len(parts) == 5 && parts[2] == "light" && parts[4] == "rgb":
+		n, err := strconv.Atoi(parts[3])
+		if err != nil || n < 1 || n > len(s.states) {
+			return noChange
+		}
+		var rgb [3]uint16
+		for i := range rgb {
+			value, ok := level(msg, i)
+			if !ok {
+				return noChange
+			}
+			rgb[i] = uint16(value*65535 + 0.5)
+		}
+		s.states[n-1] = hue.EntertainmentLightState{Red: rgb[0], Green: rgb[1], Blue: rgb[2]}
+		return lightsChanged
+	}
+	return noChange
+}
+
+// handleEffect applies a message addressed to /hue/<zone>/effect, parts holds the address after it.
+func (s *Server) handleEffect(parts []string, msg Message) bool {
+	if len(parts) == 0 {
+		if len(msg.Arguments) != 1 {
+			return false
+		}
+		name, ok := msg.Arguments[0].(string)
+		if !ok {
+			return false
+		}
+		if name != effect.Off && !slices.Contains(effect.Names(), name) {
+			return false
+		}
+		s.effect.Effect = name
+		return true
+	}
+	if len(parts) != 1 {
+		return false
+	}
+	switch parts[0] {
+	case "color":
+		var color [3]float64
+		for i := range color {
+			value, ok := level(msg, i)
+			if !ok {
+				return false
+			}
+			color[i] = value
+		}
+		s.effect.Color = &color
+		return true
+	case "origin":
+		var origin [2]float64
+		for i := range origin {
+			value, ok := msg.Float(i)
+			if !ok {
+				return false
+			}
+			origin[i] = math.Max(-1, math.Min(1, value))
+		}
+		s.effect.Origin = &origin
+		return true
+	}
+	targets := map[string]**float64{
+		"speed":     &s.effect.Speed,
+		"size":      &s.effect.Size,
+		"intensity": &s.effect.Intensity,
+		"direction": &s.effect.Direction,
+	}
+	target, ok := targets[parts[0]]
+	if !ok {
+		return false
+	}
+	value, ok := msg.Float(0)
+	if !ok {
+		return false
+	}
+	value = clamp(value)
+	*target = &value
+	return true
+}
+
+// output returns the light states with master and blackout applied.
+func (s *Server) output() []hue.EntertainmentLightState {
+	out := make([]hue.EntertainmentLightState, len(s.states))
+	if s.blackout {
+		return out
+	}
+	for i, state := range s.states {
+		out[i] = hue.EntertainmentLightState{
+			Red:   uint16(float64(state.Red)*s.master + 0.5),
+			Green: uint16(float64(state.Green)*s.master + 0.5),
+			Blue:  uint16(float64(state.Blue)*s.master + 0.5),
+		}
+	}
+	return out
+}
+
+// level returns argument i as a 0.0-1.0 level, floats are taken as is and integers as 0-255.
+func level(msg Message, i int) (float64, bool) {
+	value, ok := msg.Float(i)
+	if !ok {
+		return 0, false
+	}
+	switch msg.Arguments[i].(type) {
+	case int32, int64:
+		value /= 255
+	}
+	return clamp(value), true
+}
+
+func clamp(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
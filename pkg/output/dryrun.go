@@ -0,0 +1,29 @@
+package output
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"log"
+)
+
+func init() {
+	Register("dryrun", func(config config.Config, channels []hue.EntertainmentChannel) (Output, error) {
+		return &DryRun{}, nil
+	})
+}
+
+// DryRun logs every frame instead of sending it anywhere.
+type DryRun struct{}
+
+func (d *DryRun) Name() string {
+	return "dryrun"
+}
+
+func (d *DryRun) Write(states []hue.EntertainmentLightState) error {
+	log.Printf("Dry run: %v", states)
+	return nil
+}
+
+func (d *DryRun) Close() error {
+	return nil
+}
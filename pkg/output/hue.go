@@ -0,0 +1,35 @@
+package output
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+)
+
+func init() {
+	Register("hue", newHue)
+}
+
+// newHue starts the entertainment area and connects a streamer to it, light n is streamed to the
+// n-th channel of the entertainment configuration in channel ID order. The channels are the ones
+// the lights were patched against, so the bridge is only queried once.
+func newHue(config config.Config, channels []hue.EntertainmentChannel) (Output, error) {
+	if channels == nil {
+		return nil, fmt.Errorf("the Hue output requires the entertainment configuration from the bridge")
+	}
+	hueAppId, err := hue.GetHueApplicationID(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Hue application ID: %w", err)
+	}
+	err = hue.StartEntertainmentArea(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start entertainment area: %w", err)
+	}
+	streamer := &hue.Streamer{}
+	err = streamer.Connect(config, hueAppId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Hue bridge: %w", err)
+	}
+	streamer.SetChannels(channels)
+	return streamer, nil
+}
@@ -0,0 +1,86 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"sort"
+	"sync"
+)
+
+// Output receives a colour per light for every frame.
+type Output interface {
+	Name() string
+	Write(states []hue.EntertainmentLightState) error
+	Close() error
+}
+
+// Factory creates an output, channels are the entertainment channels read from the bridge and nil
+// when the bridge was not queried.
+type Factory func(config config.Config, channels []hue.EntertainmentChannel) (Output, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes an output available by name, it is meant to be called from init functions.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("output %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// New creates the output registered as name, channels are passed on to its factory.
+func New(name string, config config.Config, channels []hue.EntertainmentChannel) (Output, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown output %q, available: %v", name, Names())
+	}
+	return factory(config, channels)
+}
+
+// Names returns the names of all registered outputs.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Fanout writes every frame to all of its outputs.
+type Fanout []Output
+
+func (f Fanout) Name() string {
+	return "fanout"
+}
+
+func (f Fanout) Write(states []hue.EntertainmentLightState) error {
+	var errs []error
+	for _, out := range f {
+		if err := out.Write(states); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", out.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f Fanout) Close() error {
+	var errs []error
+	for _, out := range f {
+		if err := out.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", out.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,68 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"os"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("record", func(config config.Config, channels []hue.EntertainmentChannel) (Output, error) {
+		return NewRecorder(config.RecordFile)
+	})
+}
+
+// RecordedFrame is a single line in a recording.
+type RecordedFrame struct {
+	Time   time.Time                     `json:"time"`
+	Lights []hue.EntertainmentLightState `json:"lights"`
+}
+
+// Recorder writes every frame as a line of JSON to a file.
+type Recorder struct {
+	file *os.File
+	w    *bufio.Writer
+	enc  *json.Encoder
+	mu   sync.Mutex
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	if path == "" {
+		return nil, errors.New("record output requires a file to record to")
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(file)
+	return &Recorder{
+		file: file,
+		w:    w,
+		enc:  json.NewEncoder(w),
+	}, nil
+}
+
+func (r *Recorder) Name() string {
+	return "record"
+}
+
+func (r *Recorder) Write(states []hue.EntertainmentLightState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(RecordedFrame{Time: time.Now(), Lights: states})
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		_ = r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,153 @@
+package park
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Park is a parked light. A light parked without a colour keeps the colour it had when it was parked.
+type Park struct {
+	// Light is the 1-based light number in entertainment channel order.
+	Light int `json:"light"`
+	// Color is the fixed 8-bit colour, nil when the light is frozen.
+	Color *[3]uint8 `json:"color,omitempty"`
+
+	state hue.EntertainmentLightState
+	// waiting is true for frozen lights that had no frame yet, they freeze at their first frame.
+	waiting bool
+}
+
+// Parker pins parked lights to their park colour, it is safe for concurrent use.
+type Parker struct {
+	numLights int
+	parked    map[int]*Park
+	// last holds the last state of every light before parking, used to freeze lights.
+	last []hue.EntertainmentLightState
+	// seen is true for lights that had a frame, last is only valid for those.
+	seen []bool
+	mu   sync.Mutex
+}
+
+// New creates the parker with the lights parked in the config, channels are needed for entries
+// that select lights by name and may be nil otherwise.
+func New(config config.Config, channels []hue.EntertainmentChannel) (*Parker, error) {
+	p := &Parker{
+		numLights: config.NumLights,
+		parked:    make(map[int]*Park),
+		last:      make([]hue.EntertainmentLightState, config.NumLights),
+		seen:      make([]bool, config.NumLights),
+	}
+	for i, entry := range config.Park {
+		if (entry.Light != 0) == (entry.Name != "") {
+			return nil, fmt.Errorf("park entry %d must select its light by exactly one of light or name", i+1)
+		}
+		light := entry.Light
+		if entry.Name != "" {
+			if channels == nil {
+				return nil, fmt.Errorf("park entry %d: parking by name requires the entertainment configuration from the bridge", i+1)
+			}
+			index, err := hue.LightByName(channels, entry.Name)
+			if err != nil {
+				return nil, fmt.Errorf("park entry %d: %w", i+1, err)
+			}
+			light = index + 1
+		}
+		if err := p.Park(light, entry.Color); err != nil {
+			return nil, fmt.Errorf("park entry %d: %w", i+1, err)
+		}
+	}
+	return p, nil
+}
+
+// Park parks a light at a fixed colour, or at its current colour if color is nil. A light without
+// a colour yet, e.g. when parked from the config at startup, is frozen at the colour of its first frame.
+func (p *Parker) Park(light int, color *[3]uint8) error {
+	if light < 1 || light > p.numLights {
+		return fmt.Errorf("light %d out of range, must be between 1 and %d", light, p.numLights)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	park := &Park{Light: light, Color: color, state: p.last[light-1], waiting: color == nil && !p.seen[light-1]}
+	if color != nil {
+		park.state = hue.RGB8(color[0], color[1], color[2])
+	}
+	p.parked[light] = park
+	return nil
+}
+
+// Release returns a light to normal control, it returns false if the light was not parked.
+func (p *Parker) Release(light int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.parked[light]; !ok {
+		return false
+	}
+	delete(p.parked, light)
+	return true
+}
+
+// Parked returns the parked lights in light order.
+func (p *Parker) Parked() []Park {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	parked := make([]Park, 0, len(p.parked))
+	for _, park := range p.parked {
+		parked = append(parked, *park)
+	}
+	sort.Slice(parked, func(i, j int) bool { return parked[i].Light < parked[j].Light })
+	return parked
+}
+
+// Apply replaces the states of parked lights in place.
+func (p *Parker) Apply(states []hue.EntertainmentLightState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range states {
+		if i >= p.numLights {
+			break
+		}
+		if park, ok := p.parked[i+1]; ok {
+			if park.waiting {
+				park.state = states[i]
+				park.waiting = false
+			}
+			states[i] = park.state
+			continue
+		}
+		p.last[i] = states[i]
+		p.seen[i] = true
+	}
+}
+
+// ParseFlag parses a --park value: a light number optionally followed by a colon and an 8-bit colour,
+// e.g. "3" or "3:255,180,100".
+func ParseFlag(value string) (config.ParkEntry, error) {
+	lightPart, colorPart, hasColor := strings.Cut(value, ":")
+	light, err := strconv.Atoi(lightPart)
+	if err != nil {
+		return config.ParkEntry{}, fmt.Errorf("invalid park %q, expected <light>[:<red>,<green>,<blue>]", value)
+	}
+	entry := config.ParkEntry{Light: light}
+	if !hasColor {
+		return entry, nil
+	}
+	components := strings.Split(colorPart, ",")
+	if len(components) != 3 {
+		return config.ParkEntry{}, fmt.Errorf("invalid park colour %q, expected <red>,<green>,<blue>", colorPart)
+	}
+	var color [3]uint8
+	for i, component := range components {
+		v, err := strconv.ParseUint(strings.TrimSpace(component), 10, 8)
+		if err != nil {
+			return config.ParkEntry{}, fmt.Errorf("invalid park colour %q, components must be between 0 and 255", colorPart)
+		}
+		color[i] = uint8(v)
+	}
+	entry.Color = &color
+	return entry, nil
+}
@@ -0,0 +1,164 @@
+package park
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"slices"
+	"testing"
+)
+
+var testChannels = []hue.EntertainmentChannel{
+	{ID: 0, Members: []hue.ChannelMember{{DeviceID: "a", Name: "Work light"}}},
+	{ID: 1, Members: []hue.ChannelMember{{DeviceID: "b", Name: "Strip"}}},
+	{ID: 2, Members: []hue.ChannelMember{{DeviceID: "b", Name: "Strip", Index: 1}}},
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []config.ParkEntry
+		channels []hue.EntertainmentChannel
+		want     []int
+		wantErr  bool
+	}{
+		{name: "no entries"},
+		{name: "by light", entries: []config.ParkEntry{{Light: 3}}, want: []int{3}},
+		{name: "by name", entries: []config.ParkEntry{{Name: "work light"}}, channels: testChannels, want: []int{1}},
+		{name: "unknown name", entries: []config.ParkEntry{{Name: "Desk"}}, channels: testChannels, wantErr: true},
+		{name: "ambiguous name", entries: []config.ParkEntry{{Name: "Strip"}}, channels: testChannels, wantErr: true},
+		{name: "name without the bridge", entries: []config.ParkEntry{{Name: "Work light"}}, wantErr: true},
+		{name: "light and name", entries: []config.ParkEntry{{Light: 1, Name: "Work light"}}, channels: testChannels, wantErr: true},
+		{name: "no selector", entries: []config.ParkEntry{{}}, wantErr: true},
+		{name: "light out of range", entries: []config.ParkEntry{{Light: 4}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(config.Config{NumLights: 3, Park: tt.entries}, tt.channels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var lights []int
+			for _, park := range p.Parked() {
+				lights = append(lights, park.Light)
+			}
+			if !slices.Equal(lights, tt.want) {
+				t.Errorf("got parked lights %v, want %v", lights, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	red := hue.EntertainmentLightState{Red: 65535}
+	blue := hue.EntertainmentLightState{Blue: 65535}
+	green := hue.EntertainmentLightState{Green: 65535}
+	// step is a frame or a change of the parked lights before the next frame.
+	type step struct {
+		park    *config.ParkEntry
+		release int
+		frame   []hue.EntertainmentLightState
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		want  []hue.EntertainmentLightState
+	}{
+		{
+			name:  "unparked lights follow the input",
+			steps: []step{{frame: []hue.EntertainmentLightState{red, blue}}},
+			want:  []hue.EntertainmentLightState{red, blue},
+		},
+		{
+			name: "fixed colour",
+			steps: []step{
+				{park: &config.ParkEntry{Light: 2, Color: &[3]uint8{0, 255, 0}}},
+				{frame: []hue.EntertainmentLightState{red, blue}},
+			},
+			want: []hue.EntertainmentLightState{red, green},
+		},
+		{
+			name: "frozen at the current colour",
+			steps: []step{
+				{frame: []hue.EntertainmentLightState{red, blue}},
+				{park: &config.ParkEntry{Light: 1}},
+				{frame: []hue.EntertainmentLightState{green, green}},
+			},
+			want: []hue.EntertainmentLightState{red, green},
+		},
+		{
+			name: "frozen before the first frame",
+			steps: []step{
+				{park: &config.ParkEntry{Light: 1}},
+				{frame: []hue.EntertainmentLightState{blue, red}},
+				{frame: []hue.EntertainmentLightState{green, green}},
+			},
+			want: []hue.EntertainmentLightState{blue, green},
+		},
+		{
+			name: "released",
+			steps: []step{
+				{park: &config.ParkEntry{Light: 1, Color: &[3]uint8{0, 255, 0}}},
+				{frame: []hue.EntertainmentLightState{red, blue}},
+				{release: 1},
+				{frame: []hue.EntertainmentLightState{red, blue}},
+			},
+			want: []hue.EntertainmentLightState{red, blue},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(config.Config{NumLights: 2}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var states []hue.EntertainmentLightState
+			for _, s := range tt.steps {
+				switch {
+				case s.park != nil:
+					if err := p.Park(s.park.Light, s.park.Color); err != nil {
+						t.Fatal(err)
+					}
+				case s.release != 0:
+					if !p.Release(s.release) {
+						t.Fatalf("light %d was not parked", s.release)
+					}
+				default:
+					states = slices.Clone(s.frame)
+					p.Apply(states)
+				}
+			}
+			if !slices.Equal(states, tt.want) {
+				t.Errorf("got %v, want %v", states, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFlag(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    config.ParkEntry
+		wantErr bool
+	}{
+		{value: "3", want: config.ParkEntry{Light: 3}},
+		{value: "2:255,180,100", want: config.ParkEntry{Light: 2, Color: &[3]uint8{255, 180, 100}}},
+		{value: "2: 1, 2, 3", want: config.ParkEntry{Light: 2, Color: &[3]uint8{1, 2, 3}}},
+		{value: "light", wantErr: true},
+		{value: "2:255,180", wantErr: true},
+		{value: "2:256,0,0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			entry, err := ParseFlag(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if entry.Light != tt.want.Light || (entry.Color == nil) != (tt.want.Color == nil) || (entry.Color != nil && *entry.Color != *tt.want.Color) {
+				t.Errorf("got %+v, want %+v", entry, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/fixture"
+)
+
+// BlackLevel handles the low end of the brightness range of Hue lamps, which cannot dim below a minimum
+// glow and jump from there to off. Lights below the off threshold are turned off, the range above it is
+// remapped to start at the minimum brightness, and lights that are off only turn on again once they are
+// above the threshold plus the hysteresis so they do not flicker around the threshold. A light starts
+// on in its first frame if it is above the threshold.
+type BlackLevel struct {
+	// levels holds the settings of every light, nil for lights without black level handling.
+	levels []*blackLevel
+	on     []bool
+	// seen is true for lights that had a frame, their on state follows the hysteresis from then on.
+	seen []bool
+}
+
+type blackLevel struct {
+	off, min, hysteresis float64
+}
+
+// NewBlackLevel resolves the black level settings of every light, ProfileBlackLevels take precedence over BlackLevel.
+func NewBlackLevel(config config.Config) (*BlackLevel, error) {
+	var defaultLevel *blackLevel
+	if config.BlackLevel != nil {
+		defaultLevel = newBlackLevel(*config.BlackLevel)
+		if err := defaultLevel.validate(); err != nil {
+			return nil, fmt.Errorf("black level: %w", err)
+		}
+	}
+	profileLevels := make(map[string]*blackLevel)
+	for name, level := range config.ProfileBlackLevels {
+		if _, err := fixture.Lookup(name); err != nil {
+			return nil, fmt.Errorf("profile black levels: %w", err)
+		}
+		profileLevels[name] = newBlackLevel(level)
+		if err := profileLevels[name].validate(); err != nil {
+			return nil, fmt.Errorf("black level of profile %s: %w", name, err)
+		}
+	}
+
+	b := &BlackLevel{
+		levels: make([]*blackLevel, config.NumLights),
+		on:     make([]bool, config.NumLights),
+		seen:   make([]bool, config.NumLights),
+	}
+	for i := range b.levels {
+		b.levels[i] = defaultLevel
+	}
+	if len(profileLevels) == 0 {
+		return b, nil
+	}
+	// Pixel mapped lights have no profile and use the black level of all lights
+	patch, err := fixture.BuildPatch(config)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range patch {
+		if level, ok := profileLevels[p.Profile.Name]; ok {
+			b.levels[p.Light] = level
+		}
+	}
+	return b, nil
+}
+
+func newBlackLevel(level config.BlackLevel) *blackLevel {
+	return &blackLevel{off: level.Off, min: level.Min, hysteresis: level.Hysteresis}
+}
+
+func (l *blackLevel) validate() error {
+	if l.off < 0 || l.off >= 1 {
+		return fmt.Errorf("off must be at least 0 and below 1")
+	}
+	if l.min < 0 || l.min > 1 {
+		return fmt.Errorf("min must be between 0 and 1")
+	}
+	if l.hysteresis < 0 || l.off+l.hysteresis > 1 {
+		return fmt.Errorf("hysteresis must not be negative and off plus hysteresis must be at most 1")
+	}
+	return nil
+}
+
+func (b *BlackLevel) Name() string {
+	return StageBlackLevel
+}
+
+func (b *BlackLevel) Process(frame *Frame) {
+	for i := range frame.States {
+		if i >= len(b.levels) || b.levels[i] == nil {
+			continue
+		}
+		level := b.levels[i]
+		state := &frame.States[i]
+		brightness := float64(max(state.Red, state.Green, state.Blue)) / 65535
+		switch {
+		case brightness == 0 || brightness < level.off:
+			b.on[i] = false
+		case brightness >= level.off+level.hysteresis || !b.seen[i]:
+			b.on[i] = true
+		}
+		b.seen[i] = true
+		if !b.on[i] {
+			state.Red, state.Green, state.Blue = 0, 0, 0
+			continue
+		}
+		remapped := level.min + (brightness-level.off)/(1-level.off)*(1-level.min)
+		limit(state, remapped/brightness)
+	}
+}
@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"slices"
+	"testing"
+)
+
+func TestNewBlackLevel(t *testing.T) {
+	tests := []struct {
+		name          string
+		blackLevel    *config.BlackLevel
+		profileLevels map[string]config.BlackLevel
+		wantErr       bool
+	}{
+		{name: "no black level"},
+		{name: "valid", blackLevel: &config.BlackLevel{Off: 0.02, Min: 0.05, Hysteresis: 0.01}},
+		{name: "off at 1", blackLevel: &config.BlackLevel{Off: 1}, wantErr: true},
+		{name: "min above 1", blackLevel: &config.BlackLevel{Min: 1.5}, wantErr: true},
+		{name: "hysteresis above 1", blackLevel: &config.BlackLevel{Off: 0.5, Hysteresis: 0.6}, wantErr: true},
+		{name: "unknown profile", profileLevels: map[string]config.BlackLevel{"nope": {}}, wantErr: true},
+		{name: "invalid profile level", profileLevels: map[string]config.BlackLevel{"rgb": {Min: -1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewBlackLevel(config.Config{NumLights: 1, BlackLevel: tt.blackLevel, ProfileBlackLevels: tt.profileLevels})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBlackLevel(t *testing.T) {
+	// Brightness from off (0.2) to 1 is remapped to min (0.6) to 1, so brightness b becomes 0.5 + b/2.
+	// Lights that are off turn on again from 0.3.
+	level := &config.BlackLevel{Off: 0.2, Min: 0.6, Hysteresis: 0.1}
+	tests := []struct {
+		name string
+		// reds are the red values of the frames, the result of the last frame is checked.
+		reds []uint16
+		want hue.EntertainmentLightState
+	}{
+		{name: "black", reds: []uint16{0}, want: hue.EntertainmentLightState{}},
+		{name: "below off", reds: []uint16{13000}, want: hue.EntertainmentLightState{}},
+		{name: "full", reds: []uint16{65535}, want: hue.EntertainmentLightState{Red: 65535}},
+		{name: "remapped", reds: []uint16{15001}, want: hue.EntertainmentLightState{Red: 40268}},
+		{name: "first frame within the hysteresis", reds: []uint16{16001}, want: hue.EntertainmentLightState{Red: 40768}},
+		{name: "off stays off within the hysteresis", reds: []uint16{0, 16001}, want: hue.EntertainmentLightState{}},
+		{name: "on stays on within the hysteresis", reds: []uint16{65535, 16001}, want: hue.EntertainmentLightState{Red: 40768}},
+		{name: "off turns on above the hysteresis", reds: []uint16{0, 16001, 20001}, want: hue.EntertainmentLightState{Red: 42768}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBlackLevel(config.Config{NumLights: 1, BlackLevel: level})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var frame Frame
+			for _, red := range tt.reds {
+				frame = Frame{States: []hue.EntertainmentLightState{{Red: red}}}
+				b.Process(&frame)
+			}
+			if frame.States[0] != tt.want {
+				t.Errorf("got %v, want %v", frame.States[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestBlackLevelKeepsColour(t *testing.T) {
+	b, err := NewBlackLevel(config.Config{NumLights: 2, BlackLevel: &config.BlackLevel{Off: 0.2, Min: 0.6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := Frame{States: []hue.EntertainmentLightState{{Red: 65535, Green: 32768}, {Green: 26214, Blue: 13107}}}
+	b.Process(&frame)
+	// The second light has a brightness just below 0.4, remapped to just below 0.7
+	want := []hue.EntertainmentLightState{{Red: 65535, Green: 32768}, {Green: 45874, Blue: 22937}}
+	if !slices.Equal(frame.States, want) {
+		t.Errorf("got %v, want %v", frame.States, want)
+	}
+}
@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/fixture"
+	"log"
+	"slices"
+)
+
+// Decode is the first stage of the pipeline, it turns the input of a frame into the states of all lights with
+// the fixture profiles, the pixel map and the effects of the decoder. Masters and dimmer curves are separate
+// stages, see StageMaster and StageGamma.
+type Decode struct {
+	decoder *fixture.Decoder
+}
+
+func NewDecode(decoder *fixture.Decoder) *Decode {
+	return &Decode{decoder: decoder}
+}
+
+func (d *Decode) Name() string {
+	return StageDecode
+}
+
+func (d *Decode) Process(frame *Frame) {
+	input := frame.Input
+	switch {
+	case input == nil:
+		frame.States = d.decoder.Render(frame.Time)
+	case input.Effect != nil:
+		states, err := d.decoder.SetEffect(*input.Effect)
+		if err != nil {
+			log.Printf("Failed to set effect from %s: %v", frame.Source, err)
+			states = d.decoder.Render(frame.Time)
+		}
+		frame.States = states
+	case input.DMX != nil:
+		frame.States, _ = d.decoder.Decode(input.Universe, input.DMX)
+	default:
+		// Later stages change the states in place, the source may still hold the lights
+		frame.States = slices.Clone(input.Lights)
+	}
+}
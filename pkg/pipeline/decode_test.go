@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/fixture"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"github.com/techwolf12/artnet-to-hue/pkg/source"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testDecoder patches light 1 as an RGB fixture at address 1 with a grand master at address 4.
+func testDecoder(t *testing.T, curve string) *fixture.Decoder {
+	decoder, err := fixture.NewDecoder(config.Config{
+		NumLights:   2,
+		Profile:     "rgb",
+		Patch:       []config.PatchEntry{{Light: 1, Address: 1, Profile: "rgb"}},
+		GrandMaster: &config.DMXAddress{Address: 4},
+		DimmerCurve: curve,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoder
+}
+
+func TestDecode(t *testing.T) {
+	lights := []hue.EntertainmentLightState{{Red: 1}, {Blue: 2}}
+	tests := []struct {
+		name   string
+		inputs []*source.Frame
+		want   []hue.EntertainmentLightState
+	}{
+		{
+			name:   "dmx",
+			inputs: []*source.Frame{{DMX: []byte{255, 0, 51, 255}}},
+			want:   []hue.EntertainmentLightState{{Red: 65535, Blue: 13107}, {}},
+		},
+		{
+			name:   "rendered from the last dmx",
+			inputs: []*source.Frame{{DMX: []byte{0, 255, 0, 255}}, nil},
+			want:   []hue.EntertainmentLightState{{Green: 65535}, {}},
+		},
+		{
+			name:   "lights",
+			inputs: []*source.Frame{{Lights: lights}},
+			want:   lights,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecode(testDecoder(t, ""))
+			var frame Frame
+			for _, input := range tt.inputs {
+				frame = Frame{Time: time.Now(), Input: input}
+				d.Process(&frame)
+			}
+			if !slices.Equal(frame.States, tt.want) {
+				t.Errorf("got %v, want %v", frame.States, tt.want)
+			}
+		})
+	}
+	// Later stages change the states in place, the lights of the source must not change with them
+	d := NewDecode(testDecoder(t, ""))
+	frame := Frame{Input: &source.Frame{Lights: lights}}
+	d.Process(&frame)
+	frame.States[0].Red = 100
+	if lights[0].Red != 1 {
+		t.Errorf("decoding changed the lights of the source")
+	}
+}
+
+func TestMasterAndGamma(t *testing.T) {
+	tests := []struct {
+		name   string
+		curve  string
+		stages []string
+		want   hue.EntertainmentLightState
+	}{
+		{name: "decode only", stages: []string{StageDecode}, want: hue.EntertainmentLightState{Red: 32896}},
+		{name: "master", stages: []string{StageDecode, StageMaster}, want: hue.EntertainmentLightState{Red: 16513}},
+		{name: "gamma", curve: "square", stages: []string{StageDecode, StageGamma}, want: hue.EntertainmentLightState{Red: 16513}},
+		// The curve applies to the intensity after the master, so the order of the stages matters
+		{name: "master before gamma", curve: "square", stages: []string{StageDecode, StageMaster, StageGamma}, want: hue.EntertainmentLightState{Red: 4161}},
+		{name: "gamma before master", curve: "square", stages: []string{StageDecode, StageGamma, StageMaster}, want: hue.EntertainmentLightState{Red: 8289}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := testDecoder(t, tt.curve)
+			processors, err := Select(tt.stages, []Processor{
+				NewDecode(decoder),
+				StateFunc(StageMaster, decoder.Master),
+				StateFunc(StageGamma, decoder.Curve),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Half red at half grand master
+			frame := Frame{Time: time.Now(), Input: &source.Frame{DMX: []byte{128, 0, 0, 128}}}
+			for _, p := range processors {
+				p.Process(&frame)
+			}
+			if frame.States[0] != tt.want {
+				t.Errorf("got %v, want %v", frame.States[0], tt.want)
+			}
+		})
+	}
+}
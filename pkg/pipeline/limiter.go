@@ -0,0 +1,70 @@
+package pipeline
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"math"
+)
+
+// Limiter caps the brightness of single lights and of the whole zone, keeping the colour of every light.
+type Limiter struct {
+	// max is the highest brightness of a single light and average the highest mean brightness of all lights (0.0-1.0).
+	max, average float64
+}
+
+// NewLimiter creates the limiter from the config, without limits it leaves frames unchanged.
+func NewLimiter(config config.Config) (*Limiter, error) {
+	l := &Limiter{max: 1, average: 1}
+	if config.Limiter == nil {
+		return l, nil
+	}
+	if config.Limiter.Max != nil {
+		l.max = *config.Limiter.Max
+	}
+	if config.Limiter.Average != nil {
+		l.average = *config.Limiter.Average
+	}
+	if l.max < 0 || l.max > 1 {
+		return nil, fmt.Errorf("limiter max must be between 0 and 1")
+	}
+	if l.average < 0 || l.average > 1 {
+		return nil, fmt.Errorf("limiter average must be between 0 and 1")
+	}
+	return l, nil
+}
+
+func (l *Limiter) Name() string {
+	return StageLimiter
+}
+
+func (l *Limiter) Process(frame *Frame) {
+	if len(frame.States) == 0 {
+		return
+	}
+	ceiling := math.Round(l.max * 65535)
+	total := 0.0
+	for i := range frame.States {
+		state := &frame.States[i]
+		brightness := float64(max(state.Red, state.Green, state.Blue))
+		if brightness > ceiling {
+			limit(state, ceiling/brightness)
+			brightness = ceiling
+		}
+		total += brightness
+	}
+	mean := total / float64(len(frame.States))
+	if mean <= l.average*65535 {
+		return
+	}
+	for i := range frame.States {
+		limit(&frame.States[i], l.average*65535/mean)
+	}
+}
+
+// limit scales the brightness of a light, its brightest colour, by level. Scaling all colours keeps the colour.
+func limit(state *hue.EntertainmentLightState, level float64) {
+	state.Red = uint16(math.Round(float64(state.Red) * level))
+	state.Green = uint16(math.Round(float64(state.Green) * level))
+	state.Blue = uint16(math.Round(float64(state.Blue) * level))
+}
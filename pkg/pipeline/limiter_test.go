@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"slices"
+	"testing"
+)
+
+func TestNewLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter *config.Limiter
+		wantErr bool
+	}{
+		{name: "no limits"},
+		{name: "max", limiter: &config.Limiter{Max: ptr(0.5)}},
+		{name: "average", limiter: &config.Limiter{Average: ptr(1.0)}},
+		{name: "max above 1", limiter: &config.Limiter{Max: ptr(1.5)}, wantErr: true},
+		{name: "negative average", limiter: &config.Limiter{Average: ptr(-0.1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLimiter(config.Config{Limiter: tt.limiter})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter *config.Limiter
+		states  []hue.EntertainmentLightState
+		want    []hue.EntertainmentLightState
+	}{
+		{
+			name:   "no limits",
+			states: []hue.EntertainmentLightState{{Red: 65535, Green: 65535, Blue: 65535}},
+			want:   []hue.EntertainmentLightState{{Red: 65535, Green: 65535, Blue: 65535}},
+		},
+		{
+			name:    "max keeps the colour",
+			limiter: &config.Limiter{Max: ptr(0.5)},
+			states:  []hue.EntertainmentLightState{{Red: 65535, Green: 32768}, {Blue: 10000}},
+			want:    []hue.EntertainmentLightState{{Red: 32768, Green: 16384}, {Blue: 10000}},
+		},
+		{
+			name:    "average scales all lights",
+			limiter: &config.Limiter{Average: ptr(0.25)},
+			states:  []hue.EntertainmentLightState{{Red: 65535}, {Green: 0}},
+			want:    []hue.EntertainmentLightState{{Red: 32768}, {}},
+		},
+		{
+			name:    "average below the limit",
+			limiter: &config.Limiter{Average: ptr(0.5)},
+			states:  []hue.EntertainmentLightState{{Red: 65535}, {Green: 0}},
+			want:    []hue.EntertainmentLightState{{Red: 65535}, {}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewLimiter(config.Config{Limiter: tt.limiter})
+			if err != nil {
+				t.Fatal(err)
+			}
+			frame := Frame{States: tt.states}
+			l.Process(&frame)
+			if !slices.Equal(frame.States, tt.want) {
+				t.Errorf("got %v, want %v", frame.States, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
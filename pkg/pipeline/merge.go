@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+)
+
+// Merge combines the latest frame of every source, the highest value of every colour wins (HTP).
+// Without it the latest frame of any source replaces all lights.
+type Merge struct {
+	layers map[string][]hue.EntertainmentLightState
+}
+
+func NewMerge() *Merge {
+	return &Merge{layers: make(map[string][]hue.EntertainmentLightState)}
+}
+
+func (m *Merge) Name() string {
+	return StageMerge
+}
+
+func (m *Merge) Process(frame *Frame) {
+	m.layers[frame.Layer] = append(m.layers[frame.Layer][:0], frame.States...)
+	if len(m.layers) == 1 {
+		return
+	}
+	var merged []hue.EntertainmentLightState
+	for _, states := range m.layers {
+		for i, state := range states {
+			if i >= len(merged) {
+				merged = append(merged, state)
+				continue
+			}
+			merged[i].Red = max(merged[i].Red, state.Red)
+			merged[i].Green = max(merged[i].Green, state.Green)
+			merged[i].Blue = max(merged[i].Blue, state.Blue)
+			merged[i].Strobe = max(merged[i].Strobe, state.Strobe)
+		}
+	}
+	frame.States = merged
+}
@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"slices"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []Frame
+		want   []hue.EntertainmentLightState
+	}{
+		{
+			name:   "single layer",
+			frames: []Frame{{Layer: "a", States: []hue.EntertainmentLightState{{Red: 100, Green: 200}}}},
+			want:   []hue.EntertainmentLightState{{Red: 100, Green: 200}},
+		},
+		{
+			name: "highest value wins",
+			frames: []Frame{
+				{Layer: "a", States: []hue.EntertainmentLightState{{Red: 100, Green: 200, Strobe: 10}}},
+				{Layer: "b", States: []hue.EntertainmentLightState{{Red: 300, Blue: 50}}},
+			},
+			want: []hue.EntertainmentLightState{{Red: 300, Green: 200, Blue: 50, Strobe: 10}},
+		},
+		{
+			name: "frames replace their layer",
+			frames: []Frame{
+				{Layer: "a", States: []hue.EntertainmentLightState{{Red: 500}}},
+				{Layer: "b", States: []hue.EntertainmentLightState{{Red: 100}}},
+				{Layer: "a", States: []hue.EntertainmentLightState{{Red: 50}}},
+			},
+			want: []hue.EntertainmentLightState{{Red: 100}},
+		},
+		{
+			name: "layers with fewer lights",
+			frames: []Frame{
+				{Layer: "a", States: []hue.EntertainmentLightState{{Red: 100}}},
+				{Layer: "b", States: []hue.EntertainmentLightState{{Green: 100}, {Blue: 100}}},
+			},
+			want: []hue.EntertainmentLightState{{Red: 100, Green: 100}, {Blue: 100}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMerge()
+			var frame Frame
+			for _, f := range tt.frames {
+				frame = f
+				m.Process(&frame)
+			}
+			if !slices.Equal(frame.States, tt.want) {
+				t.Errorf("got %v, want %v", frame.States, tt.want)
+			}
+		})
+	}
+}
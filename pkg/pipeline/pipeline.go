@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/fixture"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"github.com/techwolf12/artnet-to-hue/pkg/output"
+	"github.com/techwolf12/artnet-to-hue/pkg/source"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Names of the processing stages.
+const (
+	StageDecode      = "decode"
+	StageMerge       = "merge"
+	StageMaster      = "master"
+	StageGamma       = "gamma"
+	StageSmoothing   = "smoothing"
+	StagePark        = "park"
+	StageLimiter     = "limiter"
+	StageCalibration = "calibration"
+	StageBlackLevel  = "black-level"
+	StageLatency     = "latency"
+
+	// decoderLayer is the merge layer of all frames rendered by the decoder, DMX and effects from
+	// every source end up in the same decoder state.
+	decoderLayer = "decoder"
+	renderSource = "render"
+)
+
+// DefaultStages is the order of the stages when the config does not set one.
+// Stages without settings, like smoothing with a time of 0, leave the frame unchanged.
+var DefaultStages = []string{StageDecode, StageMaster, StageGamma, StageSmoothing, StagePark, StageLimiter, StageCalibration, StageBlackLevel, StageLatency}
+
+// Frame is the colour of every light on its way from the sources to the outputs.
+type Frame struct {
+	// Source is the input the frame came from, or render for frames rendered on the timer.
+	Source string
+	// Layer groups frames that replace each other when merging sources.
+	Layer string
+	Time  time.Time
+	// Input is the frame as received from the source, it is turned into states by the decode stage.
+	// It is nil for frames rendered from the decoder on the timer.
+	Input  *source.Frame
+	States []hue.EntertainmentLightState
+}
+
+// Processor is a stage of the pipeline, it changes the states of a frame in place or replaces them.
+type Processor interface {
+	Name() string
+	Process(frame *Frame)
+}
+
+// animator is implemented by processors that keep changing lights without new frames.
+type animator interface {
+	Animating() bool
+}
+
+// Select returns the processors named by stages in the order of stages, the first stage must be decode.
+func Select(stages []string, processors []Processor) ([]Processor, error) {
+	if len(stages) == 0 || stages[0] != StageDecode {
+		return nil, fmt.Errorf("the pipeline must start with the %s stage", StageDecode)
+	}
+	var selected []Processor
+	for i, name := range stages {
+		if slices.Contains(stages[:i], name) {
+			return nil, fmt.Errorf("pipeline stage %q is used more than once", name)
+		}
+		j := slices.IndexFunc(processors, func(p Processor) bool { return p.Name() == name })
+		if j < 0 {
+			return nil, fmt.Errorf("unknown pipeline stage %q, available: %v", name, Names())
+		}
+		selected = append(selected, processors[j])
+	}
+	return selected, nil
+}
+
+// Names returns the names of all stages.
+func Names() []string {
+	return []string{StageDecode, StageMerge, StageMaster, StageGamma, StageSmoothing, StagePark, StageLimiter, StageCalibration, StageBlackLevel, StageLatency}
+}
+
+// Pipeline runs the frames of all sources through its processors and writes them to the output.
+// It is safe for concurrent use.
+type Pipeline struct {
+	decoder    *fixture.Decoder
+	processors []Processor
+	out        output.Output
+	debug      bool
+
+	mu sync.Mutex
+	// last is the most recent frame before processing, it is processed again while processors are animating.
+	last *Frame
+}
+
+func New(decoder *fixture.Decoder, processors []Processor, out output.Output, debug bool) *Pipeline {
+	return &Pipeline{decoder: decoder, processors: processors, out: out, debug: debug}
+}
+
+// Process runs a frame from a source through the processors and writes it to the output.
+// DMX frames on universes that are not patched are dropped.
+func (p *Pipeline) Process(frame source.Frame) {
+	if frame.DMX != nil && !p.decoder.Patched(frame.Universe) {
+		return
+	}
+	layer := frame.Source
+	if frame.DMX != nil || frame.Effect != nil {
+		layer = decoderLayer
+	}
+	p.run(&Frame{Source: frame.Source, Layer: layer, Time: time.Now(), Input: &frame})
+}
+
+// Render writes the lights again if the decoder or any processor changes them without new frames,
+// it is meant to be called at the rate the bridge updates its lights.
+func (p *Pipeline) Render(now time.Time) {
+	if p.decoder.Animating() {
+		p.run(&Frame{Source: renderSource, Layer: decoderLayer, Time: now})
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last == nil || !p.animating() {
+		return
+	}
+	p.process(&Frame{Source: renderSource, Layer: p.last.Layer, Time: now, Input: p.last.Input})
+}
+
+// animating returns true if any processor changes lights without new frames, it must be called with the lock held.
+func (p *Pipeline) animating() bool {
+	for _, processor := range p.processors {
+		if a, ok := processor.(animator); ok && a.Animating() {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneInput copies a source frame, sources may reuse their buffers after the frame is processed.
+func cloneInput(input *source.Frame) *source.Frame {
+	if input == nil {
+		return nil
+	}
+	c := *input
+	c.DMX = slices.Clone(input.DMX)
+	c.Lights = slices.Clone(input.Lights)
+	return &c
+}
+
+func (p *Pipeline) run(frame *Frame) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last = &Frame{Source: frame.Source, Layer: frame.Layer, Time: frame.Time, Input: cloneInput(frame.Input)}
+	p.process(frame)
+}
+
+// process runs a frame through the processors and writes it to the output, it must be called with the lock held.
+func (p *Pipeline) process(frame *Frame) {
+	for _, processor := range p.processors {
+		processor.Process(frame)
+	}
+	if p.debug {
+		log.Printf("%s states: %v\n", frame.Source, frame.States)
+	}
+	err := p.out.Write(frame.States)
+	if err != nil {
+		log.Printf("Failed to write output: %v", err)
+	}
+}
+
+// stateFunc is a processor that only depends on the states of a frame.
+type stateFunc struct {
+	name  string
+	apply func(states []hue.EntertainmentLightState)
+}
+
+// StateFunc adapts a function that changes light states in place, like park or calibration, to a processor.
+func StateFunc(name string, apply func(states []hue.EntertainmentLightState)) Processor {
+	return &stateFunc{name: name, apply: apply}
+}
+
+func (f *stateFunc) Name() string {
+	return f.name
+}
+
+func (f *stateFunc) Process(frame *Frame) {
+	f.apply(frame.States)
+}
@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"slices"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	processors := []Processor{
+		NewDecode(nil),
+		NewMerge(),
+		NewSmoothing(0),
+		StateFunc(StagePark, func([]hue.EntertainmentLightState) {}),
+	}
+	tests := []struct {
+		name    string
+		stages  []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "decode only", stages: []string{StageDecode}, want: []string{StageDecode}},
+		{
+			name:   "in the order of stages",
+			stages: []string{StageDecode, StagePark, StageMerge},
+			want:   []string{StageDecode, StagePark, StageMerge},
+		},
+		{name: "no stages", wantErr: true},
+		{name: "decode not first", stages: []string{StageMerge, StageDecode}, wantErr: true},
+		{name: "unknown stage", stages: []string{StageDecode, "dither"}, wantErr: true},
+		{name: "stage without processor", stages: []string{StageDecode, StageLimiter}, wantErr: true},
+		{name: "stage used twice", stages: []string{StageDecode, StagePark, StageSmoothing, StagePark}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := Select(tt.stages, processors)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, p := range selected {
+				names = append(names, p.Name())
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateFunc(t *testing.T) {
+	tests := []struct {
+		name   string
+		apply  func(states []hue.EntertainmentLightState)
+		states []hue.EntertainmentLightState
+		want   []hue.EntertainmentLightState
+	}{
+		{
+			name:   "unchanged",
+			apply:  func([]hue.EntertainmentLightState) {},
+			states: []hue.EntertainmentLightState{{Red: 1}},
+			want:   []hue.EntertainmentLightState{{Red: 1}},
+		},
+		{
+			name:   "changed in place",
+			apply:  func(states []hue.EntertainmentLightState) { states[1].Blue = 100 },
+			states: []hue.EntertainmentLightState{{Red: 1}, {}},
+			want:   []hue.EntertainmentLightState{{Red: 1}, {Blue: 100}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := StateFunc(StageCalibration, tt.apply)
+			if p.Name() != StageCalibration {
+				t.Errorf("got name %q, want %q", p.Name(), StageCalibration)
+			}
+			frame := Frame{States: tt.states}
+			p.Process(&frame)
+			if !slices.Equal(frame.States, tt.want) {
+				t.Errorf("got %v, want %v", frame.States, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"math"
+	"time"
+)
+
+const (
+	// settledDifference is the 16-bit difference at which a smoothed light jumps to its target.
+	settledDifference = 64
+	maxStep           = time.Second / hue.LightUpdateRate
+)
+
+// Smoothing fades lights towards every new colour instead of jumping to it, which hides the steps of
+// slow DMX fades and the jitter of noisy inputs.
+type Smoothing struct {
+	// seconds is the time constant, after which a light has covered about 63% of a change.
+	seconds float64
+	current [][3]float64
+	target  [][3]float64
+	last    time.Time
+}
+
+// NewSmoothing creates the smoothing stage, a time of 0 disables it.
+func NewSmoothing(seconds float64) *Smoothing {
+	return &Smoothing{seconds: seconds}
+}
+
+func (s *Smoothing) Name() string {
+	return StageSmoothing
+}
+
+func (s *Smoothing) Process(frame *Frame) {
+	if s.seconds <= 0 {
+		return
+	}
+	// The first frame and lights that are added later start at their colour
+	for len(s.current) < len(frame.States) {
+		state := frame.States[len(s.current)]
+		c := [3]float64{float64(state.Red), float64(state.Green), float64(state.Blue)}
+		s.current = append(s.current, c)
+		s.target = append(s.target, c)
+	}
+	// Lights are rendered at least at the update rate while they fade, a longer gap means the lights had
+	// settled and the fade starts now
+	elapsed := max(0, min(frame.Time.Sub(s.last), maxStep))
+	alpha := 1 - math.Exp(-elapsed.Seconds()/s.seconds)
+	s.last = frame.Time
+
+	for i := range frame.States {
+		state := &frame.States[i]
+		s.target[i] = [3]float64{float64(state.Red), float64(state.Green), float64(state.Blue)}
+		for c := range s.current[i] {
+			v := s.current[i][c] + (s.target[i][c]-s.current[i][c])*alpha
+			if math.Abs(s.target[i][c]-v) < settledDifference {
+				v = s.target[i][c]
+			}
+			s.current[i][c] = v
+		}
+		state.Red = uint16(math.Round(s.current[i][0]))
+		state.Green = uint16(math.Round(s.current[i][1]))
+		state.Blue = uint16(math.Round(s.current[i][2]))
+	}
+}
+
+// Animating returns true while any light has not reached its colour.
+func (s *Smoothing) Animating() bool {
+	for i := range s.current {
+		if s.current[i] != s.target[i] {
+			return true
+		}
+	}
+	return false
+}
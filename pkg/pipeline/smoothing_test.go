@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSmoothing(t *testing.T) {
+	start := time.Unix(1000, 0)
+	// One time constant of fading covers 1-1/e of the change
+	step := uint16(math.Round(65535 * (1 - math.Exp(-1))))
+	tests := []struct {
+		name    string
+		seconds float64
+		frames  []Frame
+		want    hue.EntertainmentLightState
+		// animating is whether the light is still fading after the last frame.
+		animating bool
+	}{
+		{
+			name:    "disabled",
+			seconds: 0,
+			frames: []Frame{
+				{Time: start, States: []hue.EntertainmentLightState{{}}},
+				{Time: start.Add(maxStep), States: []hue.EntertainmentLightState{{Red: 65535}}},
+			},
+			want: hue.EntertainmentLightState{Red: 65535},
+		},
+		{
+			name:    "first frame",
+			seconds: 1,
+			frames:  []Frame{{Time: start, States: []hue.EntertainmentLightState{{Red: 1000, Blue: 2000}}}},
+			want:    hue.EntertainmentLightState{Red: 1000, Blue: 2000},
+		},
+		{
+			name:    "fades towards the colour",
+			seconds: maxStep.Seconds(),
+			frames: []Frame{
+				{Time: start, States: []hue.EntertainmentLightState{{}}},
+				{Time: start.Add(maxStep), States: []hue.EntertainmentLightState{{Red: 65535}}},
+			},
+			want:      hue.EntertainmentLightState{Red: step},
+			animating: true,
+		},
+		{
+			name:    "long gaps count as a single step",
+			seconds: maxStep.Seconds(),
+			frames: []Frame{
+				{Time: start, States: []hue.EntertainmentLightState{{}}},
+				{Time: start.Add(time.Minute), States: []hue.EntertainmentLightState{{Red: 65535}}},
+			},
+			want:      hue.EntertainmentLightState{Red: step},
+			animating: true,
+		},
+		{
+			name:    "small differences settle",
+			seconds: 1,
+			frames: []Frame{
+				{Time: start, States: []hue.EntertainmentLightState{{Green: 1000}}},
+				{Time: start.Add(maxStep), States: []hue.EntertainmentLightState{{Green: 1000 + settledDifference/2}}},
+			},
+			want: hue.EntertainmentLightState{Green: 1000 + settledDifference/2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSmoothing(tt.seconds)
+			var frame Frame
+			for _, f := range tt.frames {
+				frame = f
+				s.Process(&frame)
+			}
+			if frame.States[0] != tt.want {
+				t.Errorf("got %v, want %v", frame.States[0], tt.want)
+			}
+			if s.Animating() != tt.animating {
+				t.Errorf("animating is %v, want %v", s.Animating(), tt.animating)
+			}
+		})
+	}
+}
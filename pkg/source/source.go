@@ -0,0 +1,157 @@
+package source
+
+import (
+	"fmt"
+	"github.com/techwolf12/artnet-to-hue/pkg/config"
+	"github.com/techwolf12/artnet-to-hue/pkg/effect"
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"sort"
+	"sync"
+	"time"
+)
+
+// frameBuffer is the number of frames a source buffers before dropping new ones.
+const frameBuffer = 16
+
+// Frame is a single update received by a source.
+// DMX sources set Universe and DMX, pixel and control sources set Lights or Effect.
+type Frame struct {
+	Source   string
+	Universe uint16
+	DMX      []byte
+	Lights   []hue.EntertainmentLightState
+	// Effect selects the built-in effect instead of setting the lights.
+	Effect *effect.Settings
+	Time   time.Time
+}
+
+type Stats struct {
+	Packets   uint64
+	Frames    uint64
+	Invalid   uint64
+	Dropped   uint64
+	LastFrame time.Time
+}
+
+// Source is an input protocol that produces frames.
+type Source interface {
+	Name() string
+	Start() error
+	Stop() error
+	Frames() <-chan Frame
+	Stats() Stats
+}
+
+type Factory func(config config.Config) (Source, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a source available by name, it is meant to be called from init functions.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("source %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// New creates the source registered as name.
+func New(name string, config config.Config) (Source, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown input source %q, available: %v", name, Names())
+	}
+	return factory(config)
+}
+
+// Names returns the names of all registered sources.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Feed implements the frame channel and statistics of a Source, implementations embed it.
+type Feed struct {
+	name   string
+	frames chan Frame
+	mu     sync.Mutex
+	stats  Stats
+	closed bool
+}
+
+func NewFeed(name string) *Feed {
+	return &Feed{
+		name:   name,
+		frames: make(chan Frame, frameBuffer),
+	}
+}
+
+func (f *Feed) Name() string {
+	return f.name
+}
+
+func (f *Feed) Frames() <-chan Frame {
+	return f.frames
+}
+
+func (f *Feed) Stats() Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stats
+}
+
+// Packet counts a received packet.
+func (f *Feed) Packet() {
+	f.mu.Lock()
+	f.stats.Packets++
+	f.mu.Unlock()
+}
+
+// Invalid counts a received packet that could not be decoded.
+func (f *Feed) Invalid() {
+	f.mu.Lock()
+	f.stats.Invalid++
+	f.mu.Unlock()
+}
+
+// Send emits a frame without blocking, the frame is dropped if the consumer is behind.
+func (f *Feed) Send(frame Frame) {
+	frame.Source = f.name
+	if frame.Time.IsZero() {
+		frame.Time = time.Now()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	select {
+	case f.frames <- frame:
+		f.stats.Frames++
+		f.stats.LastFrame = frame.Time
+	default:
+		f.stats.Dropped++
+	}
+}
+
+// Close closes the frame channel, frames sent afterwards are discarded.
+func (f *Feed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.frames)
+	}
+}
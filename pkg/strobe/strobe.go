@@ -0,0 +1,164 @@
+package strobe
+
+import (
+	"github.com/techwolf12/artnet-to-hue/pkg/hue"
+	"github.com/techwolf12/artnet-to-hue/pkg/output"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxRate keeps flashes at or below 3 Hz, the limit for photosensitive viewers.
+	DefaultMaxRate = 3.0
+	// MaxRate is the fastest strobe the bridge can show, every flash needs one update to turn
+	// a light on and one to turn it off.
+	MaxRate = hue.LightUpdateRate / 2.0
+
+	// Strobe values below openThreshold leave the light on.
+	openThreshold = 10
+	minRate       = 0.5
+	// renderInterval is how often strobing lights are sent, faster than the bridge updates its lights
+	// so flashes are not delayed by a full update.
+	renderInterval = 20 * time.Millisecond
+)
+
+// Strobe is an output that turns lights with a strobe value on and off at the rate selected by their
+// strobe channel before writing them to the next output. While lights strobe, the last frame is
+// re-sent on a timer so the pattern continues between incoming frames.
+type Strobe struct {
+	next    output.Output
+	maxRate float64
+	// hold is the shortest time a strobing light stays on or off.
+	hold time.Duration
+
+	mu     sync.Mutex
+	states []hue.EntertainmentLightState
+	lights []flash
+	last   time.Time
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// flash is the strobe state of a single light.
+type flash struct {
+	// phase is the position in the current flash (0.0-1.0), the light is off during the second half.
+	phase   float64
+	off     bool
+	toggled time.Time
+}
+
+// New wraps next, strobes are capped to maxRate flashes per second and disabled with a maxRate of 0.
+func New(next output.Output, maxRate float64) *Strobe {
+	s := &Strobe{
+		next:    next,
+		maxRate: math.Min(maxRate, MaxRate),
+		done:    make(chan struct{}),
+	}
+	if s.maxRate > 0 {
+		s.hold = time.Duration(float64(time.Second) / (2 * s.maxRate))
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *Strobe) Name() string {
+	return "strobe"
+}
+
+// Write stores the states and writes them to the next output with the strobe pattern applied.
+func (s *Strobe) Write(states []hue.EntertainmentLightState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states = append(s.states[:0], states...)
+	return s.next.Write(s.render(time.Now()))
+}
+
+// Close stops re-sending strobing lights and closes the next output.
+func (s *Strobe) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	return s.next.Close()
+}
+
+func (s *Strobe) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(renderInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			if s.strobing() {
+				// Errors are reported by the next incoming frame
+				_ = s.next.Write(s.render(now))
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Strobe) strobing() bool {
+	if s.maxRate <= 0 {
+		return false
+	}
+	for _, state := range s.states {
+		if state.Strobe >= openThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the stored states with strobing lights turned off during the second half of every flash.
+// The flash of every light advances by the time since the last render at its current rate, so changing
+// the rate keeps the flash going instead of jumping to another point in it. A light never toggles faster
+// than the maximum rate allows.
+func (s *Strobe) render(now time.Time) []hue.EntertainmentLightState {
+	states := make([]hue.EntertainmentLightState, len(s.states))
+	copy(states, s.states)
+	if s.maxRate <= 0 {
+		return states
+	}
+	// Frames and the timer render with their own clock, a render can be slightly behind the last one
+	elapsed := 0.0
+	if !s.last.IsZero() {
+		elapsed = math.Max(0, now.Sub(s.last).Seconds())
+	}
+	if now.After(s.last) {
+		s.last = now
+	}
+	for len(s.lights) < len(states) {
+		s.lights = append(s.lights, flash{})
+	}
+	for i, state := range states {
+		light := &s.lights[i]
+		if state.Strobe < openThreshold {
+			// The next strobe starts with the light on
+			*light = flash{}
+			continue
+		}
+		_, light.phase = math.Modf(light.phase + elapsed*Rate(state.Strobe, s.maxRate))
+		if off := light.phase >= 0.5; off != light.off && now.Sub(light.toggled) >= s.hold {
+			light.off = off
+			light.toggled = now
+		}
+		if light.off {
+			states[i].Red, states[i].Green, states[i].Blue = 0, 0, 0
+		}
+	}
+	return states
+}
+
+// Rate returns the flashes per second for a DMX strobe value, from slow at the bottom of the
+// range to maxRate at 255.
+func Rate(value int, maxRate float64) float64 {
+	if value < openThreshold || maxRate <= 0 {
+		return 0
+	}
+	low := math.Min(minRate, maxRate)
+	return low + float64(value-openThreshold)/(255-openThreshold)*(maxRate-low)
+}